@@ -0,0 +1,98 @@
+package oauth2cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+// AuthorizationDetail represents an element of authorization_details of Rich Authorization Requests (RAR).
+// See https://www.rfc-editor.org/rfc/rfc9396#section-2
+type AuthorizationDetail struct {
+	Type       string   `json:"type"`
+	Locations  []string `json:"locations,omitempty"`
+	Actions    []string `json:"actions,omitempty"`
+	DataTypes  []string `json:"datatypes,omitempty"`
+	Identifier string   `json:"identifier,omitempty"`
+	Privileges []string `json:"privileges,omitempty"`
+
+	// Fields specific to the authorization details type,
+	// such as instructedAmount of payment_initiation.
+	Extra map[string]any `json:"-"`
+}
+
+type authorizationDetailAlias AuthorizationDetail
+
+var authorizationDetailFields = []string{"type", "locations", "actions", "datatypes", "identifier", "privileges"}
+
+// MarshalJSON encodes the common fields and Extra into a JSON object.
+func (d AuthorizationDetail) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(authorizationDetailAlias(d))
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Extra) == 0 {
+		return b, nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range d.Extra {
+		if _, exists := m[k]; exists {
+			return nil, fmt.Errorf("the common field %s must not be set in Extra", k)
+		}
+		m[k] = v
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes a JSON object into the common fields and Extra.
+func (d *AuthorizationDetail) UnmarshalJSON(b []byte) error {
+	var alias authorizationDetailAlias
+	if err := json.Unmarshal(b, &alias); err != nil {
+		return err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	for _, k := range authorizationDetailFields {
+		delete(m, k)
+	}
+	if len(m) > 0 {
+		alias.Extra = m
+	}
+	*d = AuthorizationDetail(alias)
+	return nil
+}
+
+// AuthorizationDetailsOption returns an option to send authorization_details in the authorization request.
+// You can set it to Config.AuthCodeOptions.
+func AuthorizationDetailsOption(details ...AuthorizationDetail) (oauth2.AuthCodeOption, error) {
+	b, err := json.Marshal(details)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode authorization_details: %w", err)
+	}
+	return oauth2.SetAuthURLParam("authorization_details", string(b)), nil
+}
+
+// AuthorizationDetailsFromToken returns authorization_details granted in the token response.
+// It returns nil if the token response does not contain authorization_details.
+// See https://www.rfc-editor.org/rfc/rfc9396#section-7
+func AuthorizationDetailsFromToken(token *oauth2.Token) ([]AuthorizationDetail, error) {
+	raw := token.Extra("authorization_details")
+	if raw == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization_details: %w", err)
+	}
+	var details []AuthorizationDetail
+	if err := json.Unmarshal(b, &details); err != nil {
+		return nil, fmt.Errorf("invalid authorization_details: %w", err)
+	}
+	return details, nil
+}
@@ -0,0 +1,52 @@
+package oauth2cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+// GetTokenByDeviceAuthorization performs the Device Authorization Grant Flow
+// and returns a token received from the provider.
+// This is useful when the browser cannot reach the local server, such as a remote host.
+// See https://www.rfc-editor.org/rfc/rfc8628
+//
+// This performs the following steps:
+//
+//  1. Send a device authorization request to OAuth2Config.Endpoint.DeviceAuthURL.
+//  2. Pass the user code and verification URI to DeviceAuthorizationHandler.
+//  3. Poll the token endpoint until the user completes the authorization.
+//  4. Return the token.
+//
+// The polling interval is increased on slow_down, and it stops when the device code expires or ctx is done.
+func GetTokenByDeviceAuthorization(ctx context.Context, cfg Config) (*oauth2.Token, error) {
+	if err := cfg.validateAndSetDefaults(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.OAuth2Config.Endpoint.DeviceAuthURL == "" {
+		return nil, errors.New("invalid config: OAuth2Config.Endpoint.DeviceAuthURL must be set")
+	}
+	if cfg.DeviceAuthorizationHandler == nil {
+		return nil, errors.New("invalid config: DeviceAuthorizationHandler must be set")
+	}
+	cfg.Logf("oauth2cli: sending a device authorization request to %s", cfg.OAuth2Config.Endpoint.DeviceAuthURL)
+	da, err := cfg.OAuth2Config.DeviceAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization error: %w", err)
+	}
+	if err := cfg.DeviceAuthorizationHandler(ctx, da); err != nil {
+		return nil, fmt.Errorf("device authorization handler error: %w", err)
+	}
+	cfg.Logf("oauth2cli: polling the token endpoint until the user code is authorized")
+	token, err := cfg.OAuth2Config.DeviceAccessToken(ctx, da)
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "expired_token" {
+			return nil, fmt.Errorf("device code has expired: %w", err)
+		}
+		return nil, fmt.Errorf("could not get a token by the device code: %w", err)
+	}
+	return token, nil
+}
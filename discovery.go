@@ -0,0 +1,203 @@
+package oauth2cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// providerMetadataTTL is the lifetime of the cached provider metadata.
+const providerMetadataTTL = 1 * time.Hour
+
+// ProviderMetadata represents the metadata of an authorization server.
+// See https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+// and https://www.rfc-editor.org/rfc/rfc8414#section-2
+type ProviderMetadata struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	JWKSURI                                    string   `json:"jwks_uri,omitempty"`
+	UserInfoEndpoint                           string   `json:"userinfo_endpoint,omitempty"`
+	RegistrationEndpoint                       string   `json:"registration_endpoint,omitempty"`
+	RevocationEndpoint                         string   `json:"revocation_endpoint,omitempty"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint,omitempty"`
+	PushedAuthorizationRequestEndpoint         string   `json:"pushed_authorization_request_endpoint,omitempty"`
+	EndSessionEndpoint                         string   `json:"end_session_endpoint,omitempty"`
+	ScopesSupported                            []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported                     []string `json:"response_types_supported,omitempty"`
+	ResponseModesSupported                     []string `json:"response_modes_supported,omitempty"`
+	GrantTypesSupported                        []string `json:"grant_types_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported,omitempty"`
+	AuthorizationResponseIssParameterSupported bool     `json:"authorization_response_iss_parameter_supported,omitempty"`
+	RequirePushedAuthorizationRequests         bool     `json:"require_pushed_authorization_requests,omitempty"`
+}
+
+// providerMetadataCache holds the provider metadata by the issuer until the expiry.
+type providerMetadataCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedProviderMetadata
+}
+
+type cachedProviderMetadata struct {
+	metadata ProviderMetadata
+	expiry   time.Time
+}
+
+var providerMetadatas providerMetadataCache
+
+func (c *providerMetadataCache) get(issuer string) (*ProviderMetadata, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[issuer]
+	if !ok || time.Now().After(entry.expiry) {
+		return nil, false
+	}
+	metadata := entry.metadata
+	return &metadata, true
+}
+
+func (c *providerMetadataCache) put(issuer string, metadata ProviderMetadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedProviderMetadata)
+	}
+	c.entries[issuer] = cachedProviderMetadata{metadata: metadata, expiry: time.Now().Add(providerMetadataTTL)}
+}
+
+// DiscoverProviderMetadata retrieves the metadata of the authorization server.
+// It first tries the OpenID Connect Discovery at {issuer}/.well-known/openid-configuration,
+// and then the OAuth 2.0 Authorization Server Metadata at /.well-known/oauth-authorization-server{path}.
+// The issuer in the metadata must be identical to the given issuer.
+// The metadata is cached in memory for an hour.
+func DiscoverProviderMetadata(ctx context.Context, issuer string) (*ProviderMetadata, error) {
+	if metadata, ok := providerMetadatas.get(issuer); ok {
+		return metadata, nil
+	}
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer: %w", err)
+	}
+	oidcURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	metadata, err := fetchProviderMetadata(ctx, oidcURL)
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.Response.StatusCode == http.StatusNotFound {
+		// See https://www.rfc-editor.org/rfc/rfc8414#section-3.1
+		oauthURL := (&url.URL{
+			Scheme: issuerURL.Scheme,
+			Host:   issuerURL.Host,
+			Path:   "/.well-known/oauth-authorization-server" + strings.TrimSuffix(issuerURL.Path, "/"),
+		}).String()
+		metadata, err = fetchProviderMetadata(ctx, oauthURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Issuer != issuer {
+		return nil, fmt.Errorf("issuer of the provider metadata does not match (wants %s but got %s)", issuer, metadata.Issuer)
+	}
+	providerMetadatas.put(issuer, *metadata)
+	return metadata, nil
+}
+
+func fetchProviderMetadata(ctx context.Context, metadataURL string) (*ProviderMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	_, body, err := doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the provider metadata from %s: %w", metadataURL, err)
+	}
+	var metadata ProviderMetadata
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid provider metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// NewConfigFromIssuer returns a copy of cfg with the settings from the provider metadata of the issuer.
+// This fills the following fields, unless they are already set:
+//
+//   - OAuth2Config.Endpoint.AuthURL, TokenURL and DeviceAuthURL
+//   - OAuth2Config.Endpoint.AuthStyle by token_endpoint_auth_methods_supported
+//   - Issuer, JWKSURL, UserInfoURL, EndSessionURL, RevocationURL, IntrospectionURL and RegistrationURL
+//   - PushedAuthorizationRequestURL if the provider requires PAR
+//
+// IssuerParameterPolicy is set to IssuerParameterRequired if the provider supports the iss parameter.
+// PKCE is set to true if the provider supports the code challenge method S256.
+func NewConfigFromIssuer(ctx context.Context, issuer string, cfg Config) (Config, error) {
+	metadata, err := DiscoverProviderMetadata(ctx, issuer)
+	if err != nil {
+		return Config{}, fmt.Errorf("discovery error: %w", err)
+	}
+	endpoint := &cfg.OAuth2Config.Endpoint
+	if endpoint.AuthURL == "" {
+		endpoint.AuthURL = metadata.AuthorizationEndpoint
+	}
+	if endpoint.TokenURL == "" {
+		endpoint.TokenURL = metadata.TokenEndpoint
+	}
+	if endpoint.DeviceAuthURL == "" {
+		endpoint.DeviceAuthURL = metadata.DeviceAuthorizationEndpoint
+	}
+	if endpoint.AuthStyle == oauth2.AuthStyleAutoDetect {
+		endpoint.AuthStyle = authStyleOf(metadata.TokenEndpointAuthMethodsSupported)
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = metadata.Issuer
+	}
+	if cfg.JWKSURL == "" {
+		cfg.JWKSURL = metadata.JWKSURI
+	}
+	if cfg.UserInfoURL == "" {
+		cfg.UserInfoURL = metadata.UserInfoEndpoint
+	}
+	if cfg.EndSessionURL == "" {
+		cfg.EndSessionURL = metadata.EndSessionEndpoint
+	}
+	if cfg.RevocationURL == "" {
+		cfg.RevocationURL = metadata.RevocationEndpoint
+	}
+	if cfg.IntrospectionURL == "" {
+		cfg.IntrospectionURL = metadata.IntrospectionEndpoint
+	}
+	if cfg.RegistrationURL == "" {
+		cfg.RegistrationURL = metadata.RegistrationEndpoint
+	}
+	if metadata.AuthorizationResponseIssParameterSupported {
+		cfg.IssuerParameterPolicy = IssuerParameterRequired
+	}
+	if cfg.PushedAuthorizationRequestURL == "" && metadata.RequirePushedAuthorizationRequests {
+		cfg.PushedAuthorizationRequestURL = metadata.PushedAuthorizationRequestEndpoint
+	}
+	if slices.Contains(metadata.CodeChallengeMethodsSupported, "S256") {
+		cfg.PKCE = true
+	}
+	return cfg, nil
+}
+
+// authStyleOf returns the auth style of the token endpoint by the supported methods.
+// If the methods are not given, the default is client_secret_basic.
+// See https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+func authStyleOf(methods []string) oauth2.AuthStyle {
+	if len(methods) == 0 || slices.Contains(methods, "client_secret_basic") {
+		return oauth2.AuthStyleInHeader
+	}
+	if slices.Contains(methods, "client_secret_post") {
+		return oauth2.AuthStyleInParams
+	}
+	return oauth2.AuthStyleAutoDetect
+}
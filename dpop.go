@@ -0,0 +1,181 @@
+package oauth2cli
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/int128/oauth2cli/internal/jwt"
+	"github.com/int128/oauth2cli/oauth2params"
+	"golang.org/x/oauth2"
+)
+
+// DPoPTransport is an http.RoundTripper which sends a DPoP proof in each request.
+// If Source is set, it also sends the access token in the Authorization header with the DPoP scheme.
+// If the server requires a nonce, it retries the request once with the nonce,
+// and remembers the nonce for the subsequent requests to the same origin.
+// See https://www.rfc-editor.org/rfc/rfc9449
+type DPoPTransport struct {
+	// Private key to sign DPoP proofs.
+	// This must be the same key as Config.DPoPKey to use the token bound to the key.
+	Key crypto.Signer
+
+	// Source of the access token.
+	// If nil, no access token is sent. This is useful for the token endpoint.
+	Source oauth2.TokenSource
+
+	// Base transport.
+	// Default to http.DefaultTransport.
+	Base http.RoundTripper
+
+	nonces sync.Map // origin -> nonce
+}
+
+// RoundTrip sends the request with a DPoP proof.
+func (t *DPoPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var accessToken string
+	if t.Source != nil {
+		token, err := t.Source.Token()
+		if err != nil {
+			return nil, fmt.Errorf("could not get a token: %w", err)
+		}
+		accessToken = token.AccessToken
+	}
+	origin := req.URL.Scheme + "://" + req.URL.Host
+	nonce, _ := t.nonces.Load(origin)
+	sentNonce, _ := nonce.(string)
+	resp, err := t.roundTrip(req, accessToken, sentNonce)
+	if err != nil {
+		return nil, err
+	}
+	newNonce := resp.Header.Get("DPoP-Nonce")
+	if newNonce == "" {
+		return resp, nil
+	}
+	t.nonces.Store(origin, newNonce)
+	if newNonce == sentNonce || !isUseDPoPNonceError(resp) {
+		return resp, nil
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// The body cannot be sent again.
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+	retryReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("could not get the request body for retry: %w", err)
+		}
+		retryReq.Body = body
+	}
+	return t.roundTrip(retryReq, accessToken, newNonce)
+}
+
+func (t *DPoPTransport) roundTrip(req *http.Request, accessToken, nonce string) (*http.Response, error) {
+	proof, err := newDPoPProof(t.Key, req.Method, req.URL, accessToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("DPoP", proof)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "DPoP "+accessToken)
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// isUseDPoPNonceError returns true if the server requires a DPoP nonce.
+// The authorization server responds 400 with use_dpop_nonce error,
+// and the resource server responds 401 with use_dpop_nonce error in WWW-Authenticate header.
+// See https://www.rfc-editor.org/rfc/rfc9449#section-8 and section-9
+func isUseDPoPNonceError(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return strings.Contains(resp.Header.Get("WWW-Authenticate"), "use_dpop_nonce")
+	case http.StatusBadRequest:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return false
+		}
+		var errorResponse struct {
+			ErrorCode string `json:"error"`
+		}
+		if json.Unmarshal(body, &errorResponse) != nil {
+			return false
+		}
+		return errorResponse.ErrorCode == "use_dpop_nonce"
+	}
+	return false
+}
+
+type dpopProofClaims struct {
+	JWTID           string `json:"jti"`
+	HTTPMethod      string `json:"htm"`
+	HTTPURI         string `json:"htu"`
+	IssuedAt        int64  `json:"iat"`
+	AccessTokenHash string `json:"ath,omitempty"`
+	Nonce           string `json:"nonce,omitempty"`
+}
+
+// newDPoPProof returns a DPoP proof JWT.
+// See https://www.rfc-editor.org/rfc/rfc9449#section-4.2
+func newDPoPProof(key crypto.Signer, method string, u *url.URL, accessToken, nonce string) (string, error) {
+	jwk, err := jwt.NewJWK(key.Public())
+	if err != nil {
+		return "", fmt.Errorf("invalid DPoP key: %w", err)
+	}
+	jti, err := oauth2params.NewState()
+	if err != nil {
+		return "", fmt.Errorf("could not generate a jti claim: %w", err)
+	}
+	claims := dpopProofClaims{
+		JWTID:      jti,
+		HTTPMethod: method,
+		HTTPURI:    (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+		IssuedAt:   time.Now().Unix(),
+		Nonce:      nonce,
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims.AccessTokenHash = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	proof, err := jwt.Sign(key, jwt.Header{Type: "dpop+jwt", JWK: jwk}, claims)
+	if err != nil {
+		return "", fmt.Errorf("could not sign a DPoP proof: %w", err)
+	}
+	return proof, nil
+}
+
+// dpopThumbprint returns the JWK thumbprint of the key for dpop_jkt parameter.
+// See https://www.rfc-editor.org/rfc/rfc9449#section-10
+func dpopThumbprint(key crypto.Signer) (string, error) {
+	jwk, err := jwt.NewJWK(key.Public())
+	if err != nil {
+		return "", fmt.Errorf("invalid DPoP key: %w", err)
+	}
+	return jwk.Thumbprint()
+}
+
+// withDPoPClient returns a context with the HTTP client which sends DPoP proofs.
+func withDPoPClient(ctx context.Context, key crypto.Signer) context.Context {
+	hc := *contextClient(ctx)
+	hc.Transport = &DPoPTransport{Key: key, Base: hc.Transport}
+	return context.WithValue(ctx, oauth2.HTTPClient, &hc)
+}
@@ -0,0 +1,175 @@
+package e2e_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestAuthorizationDetails(t *testing.T) {
+	testAuthorizationDetails(t, false)
+}
+
+func TestAuthorizationDetails_RequestObject(t *testing.T) {
+	testAuthorizationDetails(t, true)
+}
+
+// testAuthorizationDetails tests authorization_details in the authorization request.
+// If requestObject is true, it is sent as a JSON array in the signed request object,
+// as well as the claims parameter of OpenID Connect as a JSON object.
+func testAuthorizationDetails(t *testing.T, requestObject bool) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	details := []oauth2cli.AuthorizationDetail{
+		{
+			Type:      "payment_initiation",
+			Locations: []string{"https://example.com/payments"},
+			Actions:   []string{"initiate"},
+			Extra: map[string]any{
+				"creditorAccount": map[string]any{"iban": "DE02100100109307118603"},
+			},
+		},
+	}
+	authorizationDetailsOption, err := oauth2cli.AuthorizationDetailsOption(details...)
+	if err != nil {
+		t.Fatalf("AuthorizationDetailsOption: %s", err)
+	}
+	const claimsParam = `{"id_token":{"acr":{"essential":true}}}`
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate a key: %s", err)
+	}
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				rawDetails := req.Raw.Get("authorization_details")
+				if requestObject {
+					if !verifyES256(t, req.RequestObject, &key.PublicKey) {
+						return fmt.Sprintf("%s?error=invalid_request_object", req.RedirectURI)
+					}
+					payload := decodeRequestObjectPayload(t, req.RequestObject)
+					rawDetails = string(payload["authorization_details"])
+					var claims map[string]any
+					if err := json.Unmarshal(payload["claims"], &claims); err != nil {
+						t.Errorf("claims wants a JSON object but was %s: %s", payload["claims"], err)
+					}
+					wantClaims := map[string]any{"id_token": map[string]any{"acr": map[string]any{"essential": true}}}
+					if diff := cmp.Diff(wantClaims, claims); diff != "" {
+						t.Errorf("claims mismatch (-want +got):\n%s", diff)
+					}
+				}
+				var got []map[string]any
+				if err := json.Unmarshal([]byte(rawDetails), &got); err != nil {
+					t.Errorf("invalid authorization_details %s: %s", rawDetails, err)
+				}
+				want := []map[string]any{{
+					"type":            "payment_initiation",
+					"locations":       []any{"https://example.com/payments"},
+					"actions":         []any{"initiate"},
+					"creditorAccount": map[string]any{"iban": "DE02100100109307118603"},
+				}}
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("authorization_details mismatch (-want +got):\n%s", diff)
+				}
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				return 200, `{"access_token": "ACCESS_TOKEN","token_type": "Bearer","expires_in": 3600,
+"authorization_details": [{"type":"payment_initiation","actions":["initiate"],"creditorAccount":{"iban":"DE02100100109307118603"}}]}`
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			AuthCodeOptions:       []oauth2.AuthCodeOption{authorizationDetailsOption},
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		if requestObject {
+			cfg.AuthCodeOptions = append(cfg.AuthCodeOptions, oauth2.SetAuthURLParam("claims", claimsParam))
+			cfg.RequestObjectSigner = key
+		}
+		token, err := oauth2cli.GetToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		granted, err := oauth2cli.AuthorizationDetailsFromToken(token)
+		if err != nil {
+			t.Errorf("AuthorizationDetailsFromToken: %s", err)
+			return
+		}
+		want := []oauth2cli.AuthorizationDetail{{
+			Type:    "payment_initiation",
+			Actions: []string{"initiate"},
+			Extra: map[string]any{
+				"creditorAccount": map[string]any{"iban": "DE02100100109307118603"},
+			},
+		}}
+		if diff := cmp.Diff(want, granted); diff != "" {
+			t.Errorf("granted authorization_details mismatch (-want +got):\n%s", diff)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+}
+
+// decodeRequestObjectPayload returns the claims of the request object without conversion.
+func decodeRequestObjectPayload(t *testing.T, requestObject string) map[string]json.RawMessage {
+	parts := strings.Split(requestObject, ".")
+	if len(parts) != 3 {
+		t.Errorf("request object wants 3 parts but was %d", len(parts))
+		return nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Errorf("invalid payload of the request object: %s", err)
+		return nil
+	}
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(b, &payload); err != nil {
+		t.Errorf("invalid payload of the request object: %s", err)
+		return nil
+	}
+	return payload
+}
@@ -4,10 +4,16 @@
 package authserver
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -18,13 +24,84 @@ type AuthorizationRequest struct {
 	State       string
 	RedirectURI string
 	Raw         url.Values
+
+	// Request object if the request parameter is given.
+	// The claims are used as the parameters without verification.
+	// See https://www.rfc-editor.org/rfc/rfc9101
+	RequestObject string
 }
 
 // TokenRequest represents a token request described as:
 // https://tools.ietf.org/html/rfc6749#section-4.1.3
 type TokenRequest struct {
-	Code string
-	Raw  url.Values
+	GrantType string
+	Code      string
+	Raw       url.Values
+}
+
+// PushedAuthorizationRequest represents a pushed authorization request described as:
+// https://www.rfc-editor.org/rfc/rfc9126#section-2.1
+type PushedAuthorizationRequest struct {
+	Header http.Header
+	Raw    url.Values
+}
+
+// DeviceAuthorizationRequest represents a device authorization request described as:
+// https://www.rfc-editor.org/rfc/rfc8628#section-3.1
+type DeviceAuthorizationRequest struct {
+	ClientID string
+	Scope    string
+	Raw      url.Values
+}
+
+// ProviderMetadataRequest represents a request of the provider metadata described as:
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationRequest
+// and https://www.rfc-editor.org/rfc/rfc8414#section-3.1
+type ProviderMetadataRequest struct {
+	Path string
+}
+
+// UserInfoRequest represents a UserInfo request described as:
+// https://openid.net/specs/openid-connect-core-1_0.html#UserInfoRequest
+type UserInfoRequest struct {
+	Header http.Header
+}
+
+// EndSessionRequest represents a logout request described as:
+// https://openid.net/specs/openid-connect-rpinitiated-1_0.html#RPLogout
+type EndSessionRequest struct {
+	IDTokenHint           string
+	PostLogoutRedirectURI string
+	State                 string
+	Raw                   url.Values
+}
+
+// RegistrationRequest represents a client registration request described as:
+// https://www.rfc-editor.org/rfc/rfc7591#section-3.1
+// and https://www.rfc-editor.org/rfc/rfc7592#section-2
+type RegistrationRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+// RevocationRequest represents a revocation request described as:
+// https://www.rfc-editor.org/rfc/rfc7009#section-2.1
+type RevocationRequest struct {
+	Header        http.Header
+	Token         string
+	TokenTypeHint string
+	Raw           url.Values
+}
+
+// IntrospectionRequest represents an introspection request described as:
+// https://www.rfc-editor.org/rfc/rfc7662#section-2.1
+type IntrospectionRequest struct {
+	Header        http.Header
+	Token         string
+	TokenTypeHint string
+	Raw           url.Values
 }
 
 // Handler handles HTTP requests.
@@ -39,6 +116,52 @@ type Handler struct {
 	// See https://tools.ietf.org/html/rfc6749#section-5.1
 	// and https://tools.ietf.org/html/rfc6749#section-5.2
 	NewTokenResponse func(req TokenRequest) (int, string)
+
+	// This should return a JSON body of device authorization response or error response.
+	// See https://www.rfc-editor.org/rfc/rfc8628#section-3.2
+	NewDeviceAuthorizationResponse func(req DeviceAuthorizationRequest) (int, string)
+
+	// This should return a JSON body of pushed authorization response or error response.
+	// The parameters are stored by the request_uri in the response,
+	// and used when the authorization request contains the request_uri.
+	// See https://www.rfc-editor.org/rfc/rfc9126#section-2.2
+	NewPushedAuthorizationResponse func(req PushedAuthorizationRequest) (int, string)
+
+	// This should return a JSON body of the provider metadata.
+	// This is called for a request to /.well-known/*.
+	// See https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationResponse
+	NewProviderMetadataResponse func(req ProviderMetadataRequest) (int, string)
+
+	// This should return a JSON body or a signed JWT of UserInfo response.
+	// If the body does not start with "{", it is sent as application/jwt.
+	// See https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse
+	NewUserInfoResponse func(req UserInfoRequest) (int, string)
+
+	// This should return a URL to redirect after logout.
+	// See https://openid.net/specs/openid-connect-rpinitiated-1_0.html#RedirectionAfterLogout
+	NewEndSessionResponse func(req EndSessionRequest) string
+
+	// This should return a JSON body of client information response or error response.
+	// This is called for a request to /register and /register/*.
+	// See https://www.rfc-editor.org/rfc/rfc7591#section-3.2
+	NewRegistrationResponse func(req RegistrationRequest) (int, string)
+
+	// This should return a status code and a JSON body of revocation response.
+	// See https://www.rfc-editor.org/rfc/rfc7009#section-2.2
+	NewRevocationResponse func(req RevocationRequest) (int, string)
+
+	// This should return a status code and a JSON body or a signed JWT of introspection response.
+	// If the body does not start with "{", it is sent as application/token-introspection+jwt.
+	// See https://www.rfc-editor.org/rfc/rfc7662#section-2.2
+	// and https://www.rfc-editor.org/rfc/rfc9701#section-5
+	NewIntrospectionResponse func(req IntrospectionRequest) (int, string)
+
+	// JSON Web Key Set served at /jwks.
+	// See https://www.rfc-editor.org/rfc/rfc7517#section-5
+	JWKS string
+
+	pushedRequestsMu sync.Mutex
+	pushedRequests   map[string]url.Values
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -53,6 +176,23 @@ func (h *Handler) serveHTTP(w http.ResponseWriter, r *http.Request) error {
 	switch {
 	case r.Method == "GET" && r.URL.Path == "/auth":
 		q := r.URL.Query()
+		if requestURI := q.Get("request_uri"); requestURI != "" {
+			h.pushedRequestsMu.Lock()
+			pushed, ok := h.pushedRequests[requestURI]
+			h.pushedRequestsMu.Unlock()
+			if !ok {
+				return fmt.Errorf("unknown request_uri %s", requestURI)
+			}
+			q = pushed
+		}
+		requestObject := q.Get("request")
+		if requestObject != "" {
+			claims, err := decodeRequestObject(requestObject)
+			if err != nil {
+				return fmt.Errorf("invalid request object: %w", err)
+			}
+			q = claims
+		}
 		scope, state, redirectURI := q.Get("scope"), q.Get("state"), q.Get("redirect_uri")
 		if scope == "" {
 			return errors.New("scope is missing")
@@ -64,36 +204,212 @@ func (h *Handler) serveHTTP(w http.ResponseWriter, r *http.Request) error {
 			return errors.New("redirect_uri is missing")
 		}
 		authorizationResponseURL := h.NewAuthorizationResponse(AuthorizationRequest{
-			Scope:       scope,
-			State:       state,
-			RedirectURI: redirectURI,
-			Raw:         q,
+			Scope:         scope,
+			State:         state,
+			RedirectURI:   redirectURI,
+			Raw:           q,
+			RequestObject: requestObject,
 		})
+		if q.Get("response_mode") == "form_post" {
+			return writeFormPost(w, authorizationResponseURL)
+		}
 		http.Redirect(w, r, authorizationResponseURL, http.StatusFound)
 
 	case r.Method == "POST" && r.URL.Path == "/token":
 		if err := r.ParseForm(); err != nil {
 			return fmt.Errorf("error while parsing form: %w", err)
 		}
-		code, redirectURI := r.Form.Get("code"), r.Form.Get("redirect_uri")
-		if code == "" {
-			return errors.New("code is missing")
-		}
-		if redirectURI == "" {
-			return errors.New("redirect_uri is missing")
+		grantType, code, redirectURI := r.Form.Get("grant_type"), r.Form.Get("code"), r.Form.Get("redirect_uri")
+		if grantType == "authorization_code" {
+			if code == "" {
+				return errors.New("code is missing")
+			}
+			if redirectURI == "" {
+				return errors.New("redirect_uri is missing")
+			}
 		}
 		status, body := h.NewTokenResponse(TokenRequest{
-			Code: code,
-			Raw:  r.Form,
+			GrantType: grantType,
+			Code:      code,
+			Raw:       r.Form,
 		})
-		w.Header().Add("Content-Type", "application/json")
+		return writeJSON(w, status, body)
+
+	case r.Method == "POST" && r.URL.Path == "/par" && h.NewPushedAuthorizationResponse != nil:
+		if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("error while parsing form: %w", err)
+		}
+		status, body := h.NewPushedAuthorizationResponse(PushedAuthorizationRequest{
+			Header: r.Header,
+			Raw:    r.PostForm,
+		})
+		var resp struct {
+			RequestURI string `json:"request_uri"`
+		}
+		if err := json.Unmarshal([]byte(body), &resp); err == nil && resp.RequestURI != "" {
+			h.pushedRequestsMu.Lock()
+			if h.pushedRequests == nil {
+				h.pushedRequests = make(map[string]url.Values)
+			}
+			h.pushedRequests[resp.RequestURI] = r.PostForm
+			h.pushedRequestsMu.Unlock()
+		}
+		return writeJSON(w, status, body)
+
+	case r.Method == "GET" && strings.Contains(r.URL.Path, "/.well-known/") && h.NewProviderMetadataResponse != nil:
+		status, body := h.NewProviderMetadataResponse(ProviderMetadataRequest{Path: r.URL.Path})
+		return writeJSON(w, status, body)
+
+	case r.Method == "GET" && r.URL.Path == "/userinfo" && h.NewUserInfoResponse != nil:
+		status, body := h.NewUserInfoResponse(UserInfoRequest{Header: r.Header})
+		if strings.HasPrefix(body, "{") {
+			return writeJSON(w, status, body)
+		}
+		w.Header().Add("Content-Type", "application/jwt")
 		w.WriteHeader(status)
 		if _, err := w.Write([]byte(body)); err != nil {
 			return fmt.Errorf("error while writing response body: %w", err)
 		}
 
+	case r.Method == "GET" && r.URL.Path == "/logout" && h.NewEndSessionResponse != nil:
+		q := r.URL.Query()
+		http.Redirect(w, r, h.NewEndSessionResponse(EndSessionRequest{
+			IDTokenHint:           q.Get("id_token_hint"),
+			PostLogoutRedirectURI: q.Get("post_logout_redirect_uri"),
+			State:                 q.Get("state"),
+			Raw:                   q,
+		}), http.StatusFound)
+
+	case (r.URL.Path == "/register" || strings.HasPrefix(r.URL.Path, "/register/")) && h.NewRegistrationResponse != nil:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("error while reading request body: %w", err)
+		}
+		status, respBody := h.NewRegistrationResponse(RegistrationRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Header: r.Header,
+			Body:   string(body),
+		})
+		return writeJSON(w, status, respBody)
+
+	case r.Method == "POST" && r.URL.Path == "/revoke" && h.NewRevocationResponse != nil:
+		if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("error while parsing form: %w", err)
+		}
+		status, body := h.NewRevocationResponse(RevocationRequest{
+			Header:        r.Header,
+			Token:         r.PostForm.Get("token"),
+			TokenTypeHint: r.PostForm.Get("token_type_hint"),
+			Raw:           r.PostForm,
+		})
+		return writeJSON(w, status, body)
+
+	case r.Method == "POST" && r.URL.Path == "/introspect" && h.NewIntrospectionResponse != nil:
+		if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("error while parsing form: %w", err)
+		}
+		status, body := h.NewIntrospectionResponse(IntrospectionRequest{
+			Header:        r.Header,
+			Token:         r.PostForm.Get("token"),
+			TokenTypeHint: r.PostForm.Get("token_type_hint"),
+			Raw:           r.PostForm,
+		})
+		if strings.HasPrefix(body, "{") {
+			return writeJSON(w, status, body)
+		}
+		w.Header().Add("Content-Type", "application/token-introspection+jwt")
+		w.WriteHeader(status)
+		if _, err := w.Write([]byte(body)); err != nil {
+			return fmt.Errorf("error while writing response body: %w", err)
+		}
+
+	case r.Method == "GET" && r.URL.Path == "/jwks" && h.JWKS != "":
+		return writeJSON(w, 200, h.JWKS)
+
+	case r.Method == "POST" && r.URL.Path == "/device" && h.NewDeviceAuthorizationResponse != nil:
+		if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("error while parsing form: %w", err)
+		}
+		clientID := r.Form.Get("client_id")
+		if clientID == "" {
+			return errors.New("client_id is missing")
+		}
+		status, body := h.NewDeviceAuthorizationResponse(DeviceAuthorizationRequest{
+			ClientID: clientID,
+			Scope:    r.Form.Get("scope"),
+			Raw:      r.Form,
+		})
+		return writeJSON(w, status, body)
+
 	default:
 		http.NotFound(w, r)
 	}
 	return nil
 }
+
+func writeJSON(w http.ResponseWriter, status int, body string) error {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(body)); err != nil {
+		return fmt.Errorf("error while writing response body: %w", err)
+	}
+	return nil
+}
+
+func decodeRequestObject(requestObject string) (url.Values, error) {
+	parts := strings.Split(requestObject, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("request object must have 3 parts")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the payload: %w", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("could not decode the claims: %w", err)
+	}
+	q := make(url.Values)
+	for k, v := range claims {
+		switch v := v.(type) {
+		case string:
+			q.Set(k, v)
+		case []any:
+			for _, e := range v {
+				q.Add(k, fmt.Sprint(e))
+			}
+		default:
+			q.Set(k, fmt.Sprint(v))
+		}
+	}
+	return q, nil
+}
+
+var formPostTemplate = template.Must(template.New("form_post").Parse(`<html><body onload="document.forms[0].submit()">
+<form method="post" action="{{ .Action }}">
+{{- range $name, $values := .Params }}{{ range $values }}
+<input type="hidden" name="{{ $name }}" value="{{ . }}">
+{{- end }}{{ end }}
+</form>
+</body></html>
+`))
+
+// writeFormPost writes a page which submits the parameters of the authorization response.
+// See https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html
+func writeFormPost(w http.ResponseWriter, authorizationResponseURL string) error {
+	u, err := url.Parse(authorizationResponseURL)
+	if err != nil {
+		return fmt.Errorf("invalid authorization response URL: %w", err)
+	}
+	params := u.Query()
+	u.RawQuery = ""
+	w.Header().Add("Content-Type", "text/html")
+	if err := formPostTemplate.Execute(w, struct {
+		Action string
+		Params url.Values
+	}{Action: u.String(), Params: params}); err != nil {
+		return fmt.Errorf("error while writing response body: %w", err)
+	}
+	return nil
+}
@@ -4,9 +4,12 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"regexp"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -42,6 +45,59 @@ func Get(url string) (int, string, error) {
 	return resp.StatusCode, string(b), nil
 }
 
+var formPostPattern = regexp.MustCompile(`<form method="post" action="([^"]*)">`)
+var formPostInputPattern = regexp.MustCompile(`<input type="hidden" name="([^"]*)" value="([^"]*)">`)
+
+// GetAndSubmitForm gets the URL and submits the form in the page, like a browser does for response_mode=form_post.
+func GetAndSubmitForm(url string) (int, string, error) {
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: certPool}}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, "", fmt.Errorf("could not send a request: %w", err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return resp.StatusCode, "", fmt.Errorf("could not read response body: %w", err)
+	}
+	action := formPostPattern.FindSubmatch(b)
+	if action == nil {
+		return resp.StatusCode, string(b), fmt.Errorf("no form in the page")
+	}
+	form := make(neturl.Values)
+	for _, input := range formPostInputPattern.FindAllSubmatch(b, -1) {
+		form.Add(html.UnescapeString(string(input[1])), html.UnescapeString(string(input[2])))
+	}
+	resp, err = client.PostForm(html.UnescapeString(string(action[1])), form)
+	if err != nil {
+		return 0, "", fmt.Errorf("could not send a request: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			panic(err)
+		}
+	}()
+	b, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, "", fmt.Errorf("could not read response body: %w", err)
+	}
+	return resp.StatusCode, string(b), nil
+}
+
+func GetAndSubmitFormAndVerify(t *testing.T, url string, code int, body string) {
+	gotCode, gotBody, err := GetAndSubmitForm(url)
+	if err != nil {
+		t.Errorf("could not open browser request: %s", err)
+		return
+	}
+	if gotCode != code {
+		t.Errorf("status wants %d but %d", code, gotCode)
+	}
+	if gotBody != body {
+		t.Errorf("response body did not match: %s", cmp.Diff(gotBody, body))
+	}
+}
+
 func GetAndVerify(t *testing.T, url string, code int, body string) {
 	gotCode, gotBody, err := Get(url)
 	if err != nil {
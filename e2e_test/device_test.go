@@ -0,0 +1,208 @@
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"golang.org/x/oauth2"
+)
+
+func TestDeviceAuthorization(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+	var polls atomic.Int32
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewDeviceAuthorizationResponse: func(req authserver.DeviceAuthorizationRequest) (int, string) {
+			if want := "email profile"; req.Scope != want {
+				t.Errorf("scope wants %s but %s", want, req.Scope)
+			}
+			return 200, `{"device_code":"DEVICE_CODE","user_code":"USER-CODE","verification_uri":"https://example.com/device","expires_in":60,"interval":1}`
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			if want := "urn:ietf:params:oauth:grant-type:device_code"; req.GrantType != want {
+				t.Errorf("grant_type wants %s but %s", want, req.GrantType)
+				return 400, `{"error":"unsupported_grant_type"}`
+			}
+			if want := "DEVICE_CODE"; req.Raw.Get("device_code") != want {
+				t.Errorf("device_code wants %s but %s", want, req.Raw.Get("device_code"))
+				return 400, invalidGrantResponse
+			}
+			if polls.Add(1) == 1 {
+				return 400, `{"error":"authorization_pending"}`
+			}
+			return 200, validTokenResponse
+		},
+	})
+	defer testServer.Close()
+	var userCode string
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID: "YOUR_CLIENT_ID",
+			Scopes:   []string{"email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				DeviceAuthURL: testServer.URL + "/device",
+				TokenURL:      testServer.URL + "/token",
+			},
+		},
+		DeviceAuthorizationHandler: func(ctx context.Context, resp *oauth2.DeviceAuthResponse) error {
+			userCode = resp.UserCode
+			return nil
+		},
+		Logf: t.Logf,
+	}
+	token, err := oauth2cli.GetTokenByDeviceAuthorization(ctx, cfg)
+	if err != nil {
+		t.Fatalf("could not get a token: %s", err)
+	}
+	if userCode != "USER-CODE" {
+		t.Errorf("UserCode wants %s but %s", "USER-CODE", userCode)
+	}
+	if token.AccessToken != "ACCESS_TOKEN" {
+		t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+	}
+	if n := polls.Load(); n != 2 {
+		t.Errorf("token endpoint wants 2 polls but %d", n)
+	}
+}
+
+func TestDeviceAuthorizationSlowDown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+	var polls atomic.Int32
+	var pollTimes [2]time.Time
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewDeviceAuthorizationResponse: func(req authserver.DeviceAuthorizationRequest) (int, string) {
+			return 200, `{"device_code":"DEVICE_CODE","user_code":"USER-CODE","verification_uri":"https://example.com/device","expires_in":60,"interval":1}`
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			n := polls.Add(1)
+			if n <= 2 {
+				pollTimes[n-1] = time.Now()
+			}
+			if n == 1 {
+				return 400, `{"error":"slow_down"}`
+			}
+			return 200, validTokenResponse
+		},
+	})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID: "YOUR_CLIENT_ID",
+			Scopes:   []string{"email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				DeviceAuthURL: testServer.URL + "/device",
+				TokenURL:      testServer.URL + "/token",
+				// Do not retry a request on error, so that each poll is counted once.
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+		DeviceAuthorizationHandler: func(ctx context.Context, resp *oauth2.DeviceAuthResponse) error {
+			return nil
+		},
+		Logf: t.Logf,
+	}
+	token, err := oauth2cli.GetTokenByDeviceAuthorization(ctx, cfg)
+	if err != nil {
+		t.Fatalf("could not get a token: %s", err)
+	}
+	if token.AccessToken != "ACCESS_TOKEN" {
+		t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+	}
+	if n := polls.Load(); n != 2 {
+		t.Fatalf("token endpoint wants 2 polls but %d", n)
+	}
+	// The interval must be increased by 5 seconds on slow_down.
+	// See https://www.rfc-editor.org/rfc/rfc8628#section-3.5
+	if interval := pollTimes[1].Sub(pollTimes[0]); interval < 5*time.Second {
+		t.Errorf("interval after slow_down wants 6s but was %s", interval)
+	}
+}
+
+func TestDeviceAuthorizationContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	var canceledAt atomic.Value
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewDeviceAuthorizationResponse: func(req authserver.DeviceAuthorizationRequest) (int, string) {
+			return 200, `{"device_code":"DEVICE_CODE","user_code":"USER-CODE","verification_uri":"https://example.com/device","expires_in":60,"interval":1}`
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			// The user gives up while polling.
+			canceledAt.Store(time.Now())
+			cancel()
+			return 400, `{"error":"authorization_pending"}`
+		},
+	})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID: "YOUR_CLIENT_ID",
+			Scopes:   []string{"email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				DeviceAuthURL: testServer.URL + "/device",
+				TokenURL:      testServer.URL + "/token",
+				// Do not retry a request on error, so that each poll is counted once.
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+		DeviceAuthorizationHandler: func(ctx context.Context, resp *oauth2.DeviceAuthResponse) error {
+			return nil
+		},
+		Logf: t.Logf,
+	}
+	_, err := oauth2cli.GetTokenByDeviceAuthorization(ctx, cfg)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err wants context.Canceled but was %v", err)
+	}
+	t0, ok := canceledAt.Load().(time.Time)
+	if !ok {
+		t.Fatalf("token endpoint was not polled")
+	}
+	if elapsed := time.Since(t0); elapsed > 500*time.Millisecond {
+		t.Errorf("GetTokenByDeviceAuthorization wants to return promptly on cancel but took %s", elapsed)
+	}
+}
+
+func TestDeviceAuthorizationExpired(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewDeviceAuthorizationResponse: func(req authserver.DeviceAuthorizationRequest) (int, string) {
+			return 200, `{"device_code":"DEVICE_CODE","user_code":"USER-CODE","verification_uri":"https://example.com/device","expires_in":60,"interval":1}`
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			return 400, `{"error":"expired_token"}`
+		},
+	})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID: "YOUR_CLIENT_ID",
+			Scopes:   []string{"email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				DeviceAuthURL: testServer.URL + "/device",
+				TokenURL:      testServer.URL + "/token",
+			},
+		},
+		DeviceAuthorizationHandler: func(ctx context.Context, resp *oauth2.DeviceAuthResponse) error {
+			return nil
+		},
+		Logf: t.Logf,
+	}
+	_, err := oauth2cli.GetTokenByDeviceAuthorization(ctx, cfg)
+	if err == nil {
+		t.Fatalf("GetTokenByDeviceAuthorization wants error but was nil")
+	}
+	t.Logf("expected error: %s", err)
+}
@@ -0,0 +1,168 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestNewConfigFromIssuer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		var testServer *httptest.Server
+		testServer = httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewProviderMetadataResponse: func(req authserver.ProviderMetadataRequest) (int, string) {
+				if want := "/.well-known/openid-configuration"; req.Path != want {
+					t.Errorf("path wants %s but %s", want, req.Path)
+					return 404, `{}`
+				}
+				return 200, fmt.Sprintf(`{
+					"issuer": "%[1]s",
+					"authorization_endpoint": "%[1]s/auth",
+					"token_endpoint": "%[1]s/token",
+					"jwks_uri": "%[1]s/jwks",
+					"revocation_endpoint": "%[1]s/revoke",
+					"registration_endpoint": "%[1]s/register",
+					"token_endpoint_auth_methods_supported": ["client_secret_post"],
+					"code_challenge_methods_supported": ["plain", "S256"],
+					"authorization_response_iss_parameter_supported": true
+				}`, testServer.URL)
+			},
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				if want := "S256"; req.Raw.Get("code_challenge_method") != want {
+					t.Errorf("code_challenge_method wants %s but %s", want, req.Raw.Get("code_challenge_method"))
+				}
+				return fmt.Sprintf("%s?state=%s&code=%s&iss=%s", req.RedirectURI, req.State, "AUTH_CODE", testServer.URL)
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				if req.Raw.Get("code_verifier") == "" {
+					t.Errorf("code_verifier wants non-empty but was empty")
+				}
+				if want := "YOUR_CLIENT_SECRET"; req.Raw.Get("client_secret") != want {
+					t.Errorf("client_secret wants %s but %s", want, req.Raw.Get("client_secret"))
+				}
+				if want := "AUTH_CODE"; req.Code != want {
+					t.Errorf("code wants %s but %s", want, req.Code)
+					return 400, invalidGrantResponse
+				}
+				return 200, validTokenResponse
+			},
+		})
+		defer testServer.Close()
+		cfg, err := oauth2cli.NewConfigFromIssuer(ctx, testServer.URL, oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+			},
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		})
+		if err != nil {
+			t.Errorf("could not create a config: %s", err)
+			return
+		}
+		if want := testServer.URL + "/jwks"; cfg.JWKSURL != want {
+			t.Errorf("JWKSURL wants %s but %s", want, cfg.JWKSURL)
+		}
+		if want := testServer.URL + "/revoke"; cfg.RevocationURL != want {
+			t.Errorf("RevocationURL wants %s but %s", want, cfg.RevocationURL)
+		}
+		if want := testServer.URL + "/register"; cfg.RegistrationURL != want {
+			t.Errorf("RegistrationURL wants %s but %s", want, cfg.RegistrationURL)
+		}
+		if cfg.IssuerParameterPolicy != oauth2cli.IssuerParameterRequired {
+			t.Errorf("IssuerParameterPolicy wants IssuerParameterRequired but %v", cfg.IssuerParameterPolicy)
+		}
+		token, err := oauth2cli.GetToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+}
+
+func TestDiscoverProviderMetadata(t *testing.T) {
+	var requests atomic.Int32
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewProviderMetadataResponse: func(req authserver.ProviderMetadataRequest) (int, string) {
+			requests.Add(1)
+			if req.Path != "/.well-known/oauth-authorization-server/tenant" {
+				return 404, `{}`
+			}
+			return 200, fmt.Sprintf(`{
+				"issuer": "%[1]s/tenant",
+				"authorization_endpoint": "%[1]s/auth",
+				"token_endpoint": "%[1]s/token"
+			}`, testServer.URL)
+		},
+	})
+	defer testServer.Close()
+	issuer := testServer.URL + "/tenant"
+
+	metadata, err := oauth2cli.DiscoverProviderMetadata(context.TODO(), issuer)
+	if err != nil {
+		t.Fatalf("could not discover the provider metadata: %s", err)
+	}
+	if want := testServer.URL + "/token"; metadata.TokenEndpoint != want {
+		t.Errorf("TokenEndpoint wants %s but %s", want, metadata.TokenEndpoint)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests wants 2 but was %d", got)
+	}
+
+	if _, err := oauth2cli.DiscoverProviderMetadata(context.TODO(), issuer); err != nil {
+		t.Fatalf("could not discover the provider metadata: %s", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("provider metadata must be cached but requested %d times", got)
+	}
+}
+
+func TestDiscoverProviderMetadata_IssuerMismatch(t *testing.T) {
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewProviderMetadataResponse: func(req authserver.ProviderMetadataRequest) (int, string) {
+			return 200, `{"issuer": "https://attacker.example.com"}`
+		},
+	})
+	defer testServer.Close()
+	_, err := oauth2cli.DiscoverProviderMetadata(context.TODO(), testServer.URL)
+	if err == nil {
+		t.Errorf("DiscoverProviderMetadata wants an error but was nil")
+	}
+}
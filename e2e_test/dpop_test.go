@@ -0,0 +1,188 @@
+package e2e_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"github.com/int128/oauth2cli/internal/jwt"
+	"golang.org/x/oauth2"
+)
+
+type dpopProof struct {
+	HTTPMethod      string `json:"htm"`
+	HTTPURI         string `json:"htu"`
+	Nonce           string `json:"nonce"`
+	AccessTokenHash string `json:"ath"`
+}
+
+// verifyDPoPProof verifies the DPoP proof by the jwk header and returns the JWK thumbprint and claims.
+func verifyDPoPProof(t *testing.T, r *http.Request) (string, dpopProof) {
+	var claims dpopProof
+	token, err := jwt.Parse(r.Header.Get("DPoP"))
+	if err != nil {
+		t.Errorf("invalid DPoP proof: %s", err)
+		return "", claims
+	}
+	if token.Header.Type != "dpop+jwt" || token.Header.JWK == nil {
+		t.Errorf("DPoP proof wants typ dpop+jwt and jwk but was %+v", token.Header)
+		return "", claims
+	}
+	pub, err := token.Header.JWK.PublicKey()
+	if err != nil {
+		t.Errorf("invalid jwk: %s", err)
+		return "", claims
+	}
+	if err := token.Verify(pub); err != nil {
+		t.Errorf("could not verify the DPoP proof: %s", err)
+		return "", claims
+	}
+	if err := token.Claims(&claims); err != nil {
+		t.Errorf("invalid DPoP proof: %s", err)
+	}
+	jkt, err := token.Header.JWK.Thumbprint()
+	if err != nil {
+		t.Errorf("could not compute the thumbprint: %s", err)
+	}
+	return jkt, claims
+}
+
+func TestDPoP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate a key: %s", err)
+	}
+	jwk, err := jwt.NewJWK(key.Public())
+	if err != nil {
+		t.Fatalf("could not create a JWK: %s", err)
+	}
+	wantJKT, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("could not compute the thumbprint: %s", err)
+	}
+
+	authServer := &authserver.Handler{
+		TestingT: t,
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			if req.Raw.Get("dpop_jkt") != wantJKT {
+				t.Errorf("dpop_jkt wants %s but %s", wantJKT, req.Raw.Get("dpop_jkt"))
+			}
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			return 200, `{"access_token": "ACCESS_TOKEN","token_type": "DPoP","expires_in": 3600}`
+		},
+	}
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token" {
+			authServer.ServeHTTP(w, r)
+			return
+		}
+		jkt, proof := verifyDPoPProof(t, r)
+		if jkt != wantJKT {
+			t.Errorf("jkt wants %s but %s", wantJKT, jkt)
+		}
+		if proof.HTTPMethod != "POST" || proof.HTTPURI != testServer.URL+"/token" {
+			t.Errorf("htm and htu wants POST %s/token but %s %s", testServer.URL, proof.HTTPMethod, proof.HTTPURI)
+		}
+		if proof.Nonce != "SERVER_NONCE" {
+			w.Header().Set("DPoP-Nonce", "SERVER_NONCE")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte(`{"error":"use_dpop_nonce"}`))
+			return
+		}
+		authServer.ServeHTTP(w, r)
+	}))
+	defer testServer.Close()
+
+	openBrowserCh := make(chan string)
+	var token *oauth2.Token
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID: "YOUR_CLIENT_ID",
+				Scopes:   []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			DPoPKey:                   key,
+			DPoPBindAuthorizationCode: true,
+			LocalServerReadyChan:      openBrowserCh,
+			LocalServerMiddleware:     loggingMiddleware(t),
+			Logf:                      t.Logf,
+		}
+		token, err = oauth2cli.GetToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.TokenType != "DPoP" {
+			t.Errorf("TokenType wants DPoP but %s", token.TokenType)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+	if token == nil {
+		return
+	}
+
+	// Access the resource server by the token.
+	resourceServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "DPoP ACCESS_TOKEN" {
+			t.Errorf("Authorization wants DPoP ACCESS_TOKEN but %s", r.Header.Get("Authorization"))
+		}
+		_, proof := verifyDPoPProof(t, r)
+		sum := sha256.Sum256([]byte("ACCESS_TOKEN"))
+		if want := base64.RawURLEncoding.EncodeToString(sum[:]); proof.AccessTokenHash != want {
+			t.Errorf("ath wants %s but %s", want, proof.AccessTokenHash)
+		}
+		if proof.Nonce != "RESOURCE_NONCE" {
+			w.Header().Set("DPoP-Nonce", "RESOURCE_NONCE")
+			w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+			w.WriteHeader(401)
+			return
+		}
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer resourceServer.Close()
+	hc := &http.Client{Transport: &oauth2cli.DPoPTransport{Key: key, Source: oauth2.StaticTokenSource(token)}}
+	resp, err := hc.Get(resourceServer.URL)
+	if err != nil {
+		t.Fatalf("could not access the resource server: %s", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("status wants 200 but %d", resp.StatusCode)
+	}
+}
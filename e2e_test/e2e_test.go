@@ -2,7 +2,13 @@ package e2e_test
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -13,6 +19,7 @@ import (
 	"github.com/int128/oauth2cli"
 	"github.com/int128/oauth2cli/e2e_test/authserver"
 	"github.com/int128/oauth2cli/e2e_test/client"
+	"github.com/int128/oauth2cli/internal/jwt"
 	"golang.org/x/oauth2"
 )
 
@@ -200,3 +207,50 @@ func loggingMiddleware(t *testing.T) func(h http.Handler) http.Handler {
 		})
 	}
 }
+
+// newKeySet returns a signing key and the JSON Web Key Set of it.
+func newKeySet(t *testing.T) (crypto.Signer, string) {
+	return newKeySetWithKeyID(t, "KEY_ID")
+}
+
+func newKeySetWithKeyID(t *testing.T, keyID string) (crypto.Signer, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate a key: %s", err)
+	}
+	jwk, err := jwt.NewJWK(key.Public())
+	if err != nil {
+		t.Fatalf("could not create a JWK: %s", err)
+	}
+	jwk.KeyID = keyID
+	b, err := json.Marshal(jwt.JWKS{Keys: []jwt.JWK{*jwk}})
+	if err != nil {
+		t.Fatalf("could not encode the key set: %s", err)
+	}
+	return key, string(b)
+}
+
+func signJWT(t *testing.T, key crypto.Signer, claims any) string {
+	return signJWTWithKeyID(t, key, "KEY_ID", claims)
+}
+
+func signJWTWithKeyID(t *testing.T, key crypto.Signer, keyID string, claims any) string {
+	s, err := jwt.Sign(key, jwt.Header{KeyID: keyID}, claims)
+	if err != nil {
+		t.Fatalf("could not sign a JWT: %s", err)
+	}
+	return s
+}
+
+// withBackChannelClient returns a context with the HTTP client which connects to the test server for any host,
+// and the URL of the test server which can be reached only by the client.
+// This ensures that the back-channel requests use the HTTP client of the context.
+func withBackChannelClient(ctx context.Context, testServer *httptest.Server) (context.Context, string) {
+	addr := testServer.Listener.Addr().(*net.TCPAddr)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr.String())
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+	return ctx, fmt.Sprintf("http://authserver-%d.invalid", addr.Port)
+}
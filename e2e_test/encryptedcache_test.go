@@ -0,0 +1,153 @@
+package e2e_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/int128/oauth2cli"
+	"golang.org/x/oauth2"
+)
+
+// memoryTokenCache is a TokenCache to inspect the stored tokens.
+type memoryTokenCache map[string]*oauth2.Token
+
+func (c memoryTokenCache) Load(key oauth2cli.TokenCacheKey) (*oauth2.Token, error) {
+	return c[key.ClientID], nil
+}
+
+func (c memoryTokenCache) Save(key oauth2cli.TokenCacheKey, token *oauth2.Token) error {
+	c[key.ClientID] = token
+	return nil
+}
+
+func (c memoryTokenCache) Delete(key oauth2cli.TokenCacheKey) error {
+	delete(c, key.ClientID)
+	return nil
+}
+
+func TestEncryptedTokenCache(t *testing.T) {
+	key := oauth2cli.TokenCacheKey{Issuer: "https://issuer.example.com", ClientID: "YOUR_CLIENT_ID"}
+	token := (&oauth2.Token{AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"}).
+		WithExtra(map[string]any{"id_token": "ID_TOKEN"})
+	oldKey := oauth2cli.PassphraseKeyProvider("old", "OLD_PASSPHRASE")
+	t.Setenv("OAUTH2CLI_TEST_KEY", "NEW_SECRET")
+	newKey := oauth2cli.EnvKeyProvider("OAUTH2CLI_TEST_KEY")
+
+	storage := memoryTokenCache{}
+	cache := &oauth2cli.EncryptedTokenCache{Cache: storage, KeyProvider: oldKey}
+	if got, err := cache.Load(key); err != nil || got != nil {
+		t.Fatalf("Load of a missing token wants nil but was %+v, %v", got, err)
+	}
+	if err := cache.Save(key, token); err != nil {
+		t.Fatalf("Save error: %s", err)
+	}
+	stored := storage[key.ClientID].AccessToken
+	for _, secret := range []string{"ACCESS_TOKEN", "REFRESH_TOKEN", "ID_TOKEN"} {
+		if strings.Contains(stored, secret) {
+			t.Errorf("stored token wants encrypted but contains %s", secret)
+		}
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		got, err := cache.Load(key)
+		if err != nil {
+			t.Fatalf("Load error: %s", err)
+		}
+		if got.AccessToken != "ACCESS_TOKEN" || got.RefreshToken != "REFRESH_TOKEN" || got.Extra("id_token") != "ID_TOKEN" {
+			t.Errorf("token mismatch: %+v", got)
+		}
+	})
+
+	t.Run("WrongPassphrase", func(t *testing.T) {
+		wrongCache := &oauth2cli.EncryptedTokenCache{Cache: storage,
+			KeyProvider: oauth2cli.PassphraseKeyProvider("old", "WRONG_PASSPHRASE")}
+		if _, err := wrongCache.Load(key); !errors.Is(err, oauth2cli.ErrTokenCacheTampered) {
+			t.Errorf("err wants ErrTokenCacheTampered but was %v", err)
+		}
+	})
+
+	t.Run("AnotherKDF", func(t *testing.T) {
+		// The same secret as a random secret must not decrypt the token encrypted by the passphrase.
+		randomKey := oauth2cli.KeyProviderFunc(func() (*oauth2cli.EncryptionKey, error) {
+			return &oauth2cli.EncryptionKey{ID: "old", Secret: []byte("OLD_PASSPHRASE")}, nil
+		})
+		randomCache := &oauth2cli.EncryptedTokenCache{Cache: storage, KeyProvider: randomKey}
+		if _, err := randomCache.Load(key); !errors.Is(err, oauth2cli.ErrTokenCacheTampered) {
+			t.Errorf("err wants ErrTokenCacheTampered but was %v", err)
+		}
+	})
+
+	t.Run("KeyNotFound", func(t *testing.T) {
+		newCache := &oauth2cli.EncryptedTokenCache{Cache: storage, KeyProvider: newKey}
+		if _, err := newCache.Load(key); !errors.Is(err, oauth2cli.ErrEncryptionKeyNotFound) {
+			t.Errorf("err wants ErrEncryptionKeyNotFound but was %v", err)
+		}
+	})
+
+	t.Run("AnotherCacheKey", func(t *testing.T) {
+		anotherKey := key
+		anotherKey.Issuer = "https://attacker.example.com"
+		if _, err := cache.Load(anotherKey); !errors.Is(err, oauth2cli.ErrTokenCacheTampered) {
+			t.Errorf("err wants ErrTokenCacheTampered but was %v", err)
+		}
+	})
+
+	t.Run("PlainToken", func(t *testing.T) {
+		plainStorage := memoryTokenCache{key.ClientID: {AccessToken: "INJECTED_TOKEN"}}
+		plainCache := &oauth2cli.EncryptedTokenCache{Cache: plainStorage, KeyProvider: oldKey}
+		if _, err := plainCache.Load(key); !errors.Is(err, oauth2cli.ErrTokenCacheTampered) {
+			t.Errorf("err wants ErrTokenCacheTampered but was %v", err)
+		}
+	})
+
+	t.Run("ModifiedCiphertext", func(t *testing.T) {
+		modified := []byte(stored)
+		modified[len(modified)-2] ^= 'A' ^ 'B'
+		modifiedStorage := memoryTokenCache{key.ClientID: {AccessToken: string(modified), TokenType: storage[key.ClientID].TokenType}}
+		modifiedCache := &oauth2cli.EncryptedTokenCache{Cache: modifiedStorage, KeyProvider: oldKey}
+		if _, err := modifiedCache.Load(key); !errors.Is(err, oauth2cli.ErrTokenCacheTampered) {
+			t.Errorf("err wants ErrTokenCacheTampered but was %v", err)
+		}
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		rotatingCache := &oauth2cli.EncryptedTokenCache{Cache: storage,
+			KeyProvider:          newKey,
+			PreviousKeyProviders: []oauth2cli.KeyProvider{oldKey}}
+		got, err := rotatingCache.Load(key)
+		if err != nil {
+			t.Fatalf("Load error: %s", err)
+		}
+		if got.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants ACCESS_TOKEN but %s", got.AccessToken)
+		}
+		// The token has been re-encrypted by the new key.
+		newCache := &oauth2cli.EncryptedTokenCache{Cache: storage, KeyProvider: newKey}
+		if _, err := newCache.Load(key); err != nil {
+			t.Errorf("Load by the new key error: %s", err)
+		}
+	})
+
+	t.Run("RotatedEnvSecret", func(t *testing.T) {
+		// The secret of the same variable is rotated without PreviousKeyProviders.
+		t.Setenv("OAUTH2CLI_TEST_KEY", "ROTATED_SECRET")
+		rotatedCache := &oauth2cli.EncryptedTokenCache{Cache: storage, KeyProvider: newKey}
+		if _, err := rotatedCache.Load(key); !errors.Is(err, oauth2cli.ErrEncryptionKeyNotFound) {
+			t.Errorf("err wants ErrEncryptionKeyNotFound but was %v", err)
+		}
+	})
+}
+
+func TestCommandKeyProvider(t *testing.T) {
+	encryptionKey, err := oauth2cli.CommandKeyProvider("command", "echo", "SECRET").EncryptionKey()
+	if err != nil {
+		t.Fatalf("EncryptionKey error: %s", err)
+	}
+	if want := "SECRET"; string(encryptionKey.Secret) != want {
+		t.Errorf("Secret wants %s but %s", want, encryptionKey.Secret)
+	}
+	if _, err := oauth2cli.CommandKeyProvider("command", "false").EncryptionKey(); err == nil {
+		t.Errorf("err wants non-nil but was nil")
+	}
+}
@@ -0,0 +1,148 @@
+package e2e_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestHybridFlow(t *testing.T) {
+	testHybridFlow(t, "AUTH_CODE", false, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+}
+
+func TestHybridFlow_CodeHashMismatch(t *testing.T) {
+	testHybridFlow(t, "ANOTHER_CODE", false, 500, "authorization error\n")
+}
+
+func TestHybridFlow_ContextClient(t *testing.T) {
+	// The key set can be fetched only by the HTTP client of the context.
+	testHybridFlow(t, "AUTH_CODE", true, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+}
+
+func testHybridFlow(t *testing.T, codeHashOf string, contextClient bool, wantStatus int, wantBody string) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	key, jwks := newKeySet(t)
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		var testServer *httptest.Server
+		newIDToken := func(nonce string, extraClaims map[string]any) string {
+			claims := map[string]any{
+				"iss":   testServer.URL,
+				"sub":   "USER_ID",
+				"aud":   "YOUR_CLIENT_ID",
+				"exp":   time.Now().Add(time.Hour).Unix(),
+				"iat":   time.Now().Unix(),
+				"nonce": nonce,
+			}
+			for k, v := range extraClaims {
+				claims[k] = v
+			}
+			return signJWT(t, key, claims)
+		}
+		var nonce string
+		var nonceMu sync.Mutex
+		testServer = httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			JWKS:     jwks,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				if want := "code id_token"; req.Raw.Get("response_type") != want {
+					t.Errorf("response_type wants %s but %s", want, req.Raw.Get("response_type"))
+				}
+				if want := "form_post"; req.Raw.Get("response_mode") != want {
+					t.Errorf("response_mode wants %s but %s", want, req.Raw.Get("response_mode"))
+				}
+				nonceMu.Lock()
+				nonce = req.Raw.Get("nonce")
+				nonceMu.Unlock()
+				sum := sha256.Sum256([]byte(codeHashOf))
+				idToken := newIDToken(req.Raw.Get("nonce"), map[string]any{
+					"c_hash": base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]),
+				})
+				return fmt.Sprintf("%s?%s", req.RedirectURI, url.Values{
+					"state":    {req.State},
+					"code":     {"AUTH_CODE"},
+					"id_token": {idToken},
+				}.Encode())
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				if want := "AUTH_CODE"; req.Code != want {
+					t.Errorf("code wants %s but %s", want, req.Code)
+					return 400, invalidGrantResponse
+				}
+				nonceMu.Lock()
+				defer nonceMu.Unlock()
+				idToken := newIDToken(nonce, nil)
+				return 200, fmt.Sprintf(`{"access_token":"ACCESS_TOKEN","token_type":"Bearer","expires_in":3600,"id_token":"%s"}`, idToken)
+			},
+		})
+		defer testServer.Close()
+		ctx, backChannelURL := ctx, testServer.URL
+		if contextClient {
+			ctx, backChannelURL = withBackChannelClient(ctx, testServer)
+		}
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"openid"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: backChannelURL + "/token",
+				},
+			},
+			Issuer:                  testServer.URL,
+			JWKSURL:                 backChannelURL + "/jwks",
+			ResponseTypeCodeIDToken: true,
+			LocalServerReadyChan:    openBrowserCh,
+			LocalServerMiddleware:   loggingMiddleware(t),
+			Logf:                    t.Logf,
+		}
+		token, idToken, err := oauth2cli.GetTokenWithIDToken(ctx, cfg)
+		if wantStatus != 200 {
+			var verificationErr *oauth2cli.IDTokenVerificationError
+			if !errors.As(err, &verificationErr) || verificationErr.Claim != "c_hash" {
+				t.Errorf("err wants IDTokenVerificationError of c_hash but was %v", err)
+			}
+			return
+		}
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+		}
+		if want := "USER_ID"; idToken.Subject != want {
+			t.Errorf("Subject wants %s but %s", want, idToken.Subject)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndSubmitFormAndVerify(t, toURL, wantStatus, wantBody)
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,139 @@
+package e2e_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/internal/jwt"
+	"golang.org/x/oauth2"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	key, jwks := newKeySet(t)
+	introspection := map[string]any{
+		"active":    true,
+		"scope":     "email profile",
+		"client_id": "YOUR_CLIENT_ID",
+		"sub":       "USER_ID",
+		"aud":       "https://api.example.com",
+		"exp":       1700000000,
+		"tenant":    "TENANT_ID",
+	}
+	for name, c := range map[string]struct {
+		jwtResponse bool
+		wantAccept  string
+		newResponse func(issuer string) string
+	}{
+		"JSON": {
+			wantAccept: "application/json",
+			newResponse: func(string) string {
+				return `{"active":true,"scope":"email profile","client_id":"YOUR_CLIENT_ID","sub":"USER_ID","aud":"https://api.example.com","exp":1700000000,"tenant":"TENANT_ID"}`
+			},
+		},
+		"JWT": {
+			jwtResponse: true,
+			wantAccept:  "application/token-introspection+jwt",
+			newResponse: func(issuer string) string {
+				s, err := jwt.Sign(key, jwt.Header{KeyID: "KEY_ID", Type: "token-introspection+jwt"}, map[string]any{
+					"iss":                 issuer,
+					"aud":                 "YOUR_CLIENT_ID",
+					"iat":                 time.Now().Unix(),
+					"token_introspection": introspection,
+				})
+				if err != nil {
+					t.Fatalf("could not sign a JWT: %s", err)
+				}
+				return s
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var testServer *httptest.Server
+			testServer = httptest.NewServer(&authserver.Handler{
+				TestingT: t,
+				JWKS:     jwks,
+				NewIntrospectionResponse: func(req authserver.IntrospectionRequest) (int, string) {
+					if username, password, ok := (&http.Request{Header: req.Header}).BasicAuth(); !ok ||
+						username != "YOUR_CLIENT_ID" || password != "YOUR_CLIENT_SECRET" {
+						t.Errorf("client authentication wants basic auth but was %s", req.Header.Get("Authorization"))
+						return 401, `{"error":"invalid_client"}`
+					}
+					if req.Header.Get("Accept") != c.wantAccept {
+						t.Errorf("Accept wants %s but %s", c.wantAccept, req.Header.Get("Accept"))
+					}
+					if req.Token != "ACCESS_TOKEN" || req.TokenTypeHint != "access_token" {
+						t.Errorf("token wants ACCESS_TOKEN with the hint but was %s (%s)", req.Token, req.TokenTypeHint)
+					}
+					return 200, c.newResponse(testServer.URL)
+				},
+			})
+			defer testServer.Close()
+			cfg := oauth2cli.Config{
+				OAuth2Config: oauth2.Config{
+					ClientID:     "YOUR_CLIENT_ID",
+					ClientSecret: "YOUR_CLIENT_SECRET",
+				},
+				Issuer:                   testServer.URL,
+				JWKSURL:                  testServer.URL + "/jwks",
+				IntrospectionURL:         testServer.URL + "/introspect",
+				IntrospectionJWTResponse: c.jwtResponse,
+				Logf:                     t.Logf,
+			}
+			resp, err := oauth2cli.IntrospectToken(context.TODO(), cfg, "ACCESS_TOKEN", "access_token")
+			if err != nil {
+				t.Fatalf("IntrospectToken error: %s", err)
+			}
+			if !resp.Active {
+				t.Errorf("Active wants true")
+			}
+			if diff := cmp.Diff([]string{"email", "profile"}, resp.Scopes()); diff != "" {
+				t.Errorf("Scopes mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]string{"https://api.example.com"}, resp.Audience); diff != "" {
+				t.Errorf("Audience mismatch (-want +got):\n%s", diff)
+			}
+			if want := time.Unix(1700000000, 0); !resp.Expiry.Equal(want) {
+				t.Errorf("Expiry wants %s but %s", want, resp.Expiry)
+			}
+			var extension struct {
+				Tenant string `json:"tenant"`
+			}
+			if err := resp.Claims(&extension); err != nil {
+				t.Fatalf("Claims error: %s", err)
+			}
+			if want := "TENANT_ID"; extension.Tenant != want {
+				t.Errorf("tenant wants %s but %s", want, extension.Tenant)
+			}
+		})
+	}
+}
+
+func TestIntrospectToken_Inactive(t *testing.T) {
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewIntrospectionResponse: func(authserver.IntrospectionRequest) (int, string) {
+			return 200, `{"active":false}`
+		},
+	})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config:     oauth2.Config{ClientID: "YOUR_CLIENT_ID"},
+		IntrospectionURL: testServer.URL + "/introspect",
+	}
+	resp, err := oauth2cli.IntrospectToken(context.TODO(), cfg, "REFRESH_TOKEN", "")
+	if err != nil {
+		t.Fatalf("IntrospectToken error: %s", err)
+	}
+	if resp.Active {
+		t.Errorf("Active wants false")
+	}
+	if !resp.Expiry.IsZero() {
+		t.Errorf("Expiry wants zero but %s", resp.Expiry)
+	}
+}
@@ -0,0 +1,151 @@
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestIssuerParameter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		var testServer *httptest.Server
+		testServer = httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				return fmt.Sprintf("%s?state=%s&code=%s&iss=%s", req.RedirectURI, req.State, "AUTH_CODE", url.QueryEscape(testServer.URL))
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				return 200, validTokenResponse
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			Issuer:                testServer.URL,
+			IssuerParameterPolicy: oauth2cli.IssuerParameterRequired,
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		token, err := oauth2cli.GetToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+}
+
+func TestIssuerParameterMismatch(t *testing.T) {
+	for name, iss := range map[string]string{
+		"mismatch": "&iss=https%3A%2F%2Fattacker.example.com",
+		"missing":  "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+			defer cancel()
+
+			// start a local server of oauth2 endpoint
+			authzServer := httptest.NewServer(&authserver.Handler{
+				TestingT: t,
+				NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+					return fmt.Sprintf("%s?state=%s&code=%s%s", req.RedirectURI, req.State, "AUTH_CODE", iss)
+				},
+				NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+					return 500, "should not reach here"
+				},
+			})
+			defer authzServer.Close()
+
+			// start a local server to be redirected
+			pageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/failure" && r.Method == "GET" {
+					_, _ = w.Write([]byte("failure page"))
+					return
+				}
+				http.NotFound(w, r)
+			}))
+			defer pageServer.Close()
+
+			openBrowserCh := make(chan string)
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer close(openBrowserCh)
+				cfg := oauth2cli.Config{
+					OAuth2Config: oauth2.Config{
+						ClientID:     "YOUR_CLIENT_ID",
+						ClientSecret: "YOUR_CLIENT_SECRET",
+						Scopes:       []string{"email", "profile"},
+						Endpoint: oauth2.Endpoint{
+							AuthURL:  authzServer.URL + "/auth",
+							TokenURL: authzServer.URL + "/token",
+						},
+					},
+					Issuer:                authzServer.URL,
+					IssuerParameterPolicy: oauth2cli.IssuerParameterRequired,
+					LocalServerReadyChan:  openBrowserCh,
+					SuccessRedirectURL:    pageServer.URL + "/success",
+					FailureRedirectURL:    pageServer.URL + "/failure",
+					Logf:                  t.Logf,
+				}
+				_, err := oauth2cli.GetToken(ctx, cfg)
+				if !errors.Is(err, oauth2cli.ErrIssuerMismatch) {
+					t.Errorf("err wants ErrIssuerMismatch but %+v", err)
+				}
+			}()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				toURL, ok := <-openBrowserCh
+				if !ok {
+					t.Errorf("server already closed")
+					return
+				}
+				client.GetAndVerify(t, toURL, 200, "failure page")
+			}()
+			wg.Wait()
+		})
+	}
+}
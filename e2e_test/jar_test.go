@@ -0,0 +1,231 @@
+package e2e_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestRequestObject(t *testing.T) {
+	testRequestObject(t, false)
+}
+
+func TestRequestObjectWithPAR(t *testing.T) {
+	testRequestObject(t, true)
+}
+
+func testRequestObject(t *testing.T, par bool) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate a key: %s", err)
+	}
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewPushedAuthorizationResponse: func(req authserver.PushedAuthorizationRequest) (int, string) {
+				if req.Raw.Get("request") == "" {
+					t.Errorf("pushed authorization request wants request but was %s", req.Raw.Encode())
+				}
+				return 201, `{"request_uri":"urn:ietf:params:oauth:request_uri:REQUEST_URI","expires_in":60}`
+			},
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				if !verifyES256(t, req.RequestObject, &key.PublicKey) {
+					return fmt.Sprintf("%s?error=invalid_request_object", req.RedirectURI)
+				}
+				if want := "email profile"; req.Scope != want {
+					t.Errorf("scope wants %s but %s", want, req.Scope)
+					return fmt.Sprintf("%s?error=invalid_scope", req.RedirectURI)
+				}
+				if want := "YOUR_CLIENT_ID"; req.Raw.Get("iss") != want {
+					t.Errorf("iss wants %s but %s", want, req.Raw.Get("iss"))
+				}
+				if want := "https://issuer.example.com"; req.Raw.Get("aud") != want {
+					t.Errorf("aud wants %s but %s", want, req.Raw.Get("aud"))
+				}
+				if !assertRedirectURI(t, req.RedirectURI, "http", "localhost", "") {
+					return fmt.Sprintf("%s?error=invalid_redirect_uri", req.RedirectURI)
+				}
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				if want := "AUTH_CODE"; req.Code != want {
+					t.Errorf("code wants %s but %s", want, req.Code)
+					return 400, invalidGrantResponse
+				}
+				return 200, validTokenResponse
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			RequestObjectSigner:   key,
+			RequestObjectAudience: "https://issuer.example.com",
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		if par {
+			cfg.PushedAuthorizationRequestURL = testServer.URL + "/par"
+		}
+		token, err := oauth2cli.GetToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+}
+
+func TestRequestObject_OpenID(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	requestObjectKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate a key: %s", err)
+	}
+	idTokenKey, _ := newKeySet(t)
+	var nonce atomic.Value
+	authServer := &authserver.Handler{
+		TestingT: t,
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			if !verifyES256(t, req.RequestObject, &requestObjectKey.PublicKey) {
+				return fmt.Sprintf("%s?error=invalid_request_object", req.RedirectURI)
+			}
+			var claims map[string]any
+			payload, err := base64.RawURLEncoding.DecodeString(strings.Split(req.RequestObject, ".")[1])
+			if err != nil || json.Unmarshal(payload, &claims) != nil {
+				t.Errorf("invalid request object: %s", req.RequestObject)
+				return fmt.Sprintf("%s?error=invalid_request_object", req.RedirectURI)
+			}
+			if want := float64(300); claims["max_age"] != want {
+				t.Errorf("max_age wants a number %v but was %#v", want, claims["max_age"])
+			}
+			nonce.Store(req.Raw.Get("nonce"))
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			idToken := signJWT(t, idTokenKey, map[string]any{
+				"sub":       "USER_ID",
+				"aud":       "YOUR_CLIENT_ID",
+				"nonce":     nonce.Load(),
+				"auth_time": time.Now().Unix(),
+			})
+			return 200, fmt.Sprintf(`{"access_token":"ACCESS_TOKEN","token_type":"Bearer","expires_in":3600,"id_token":"%s"}`, idToken)
+		},
+	}
+	var authorizationRequest atomic.Value
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth" {
+			authorizationRequest.Store(r.URL.Query())
+		}
+		authServer.ServeHTTP(w, r)
+	}))
+	defer testServer.Close()
+	openBrowserCh := make(chan string)
+	defer close(openBrowserCh)
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID:     "YOUR_CLIENT_ID",
+			ClientSecret: "YOUR_CLIENT_SECRET",
+			Scopes:       []string{"openid", "email"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  testServer.URL + "/auth",
+				TokenURL: testServer.URL + "/token",
+			},
+		},
+		MaxAge:                5 * time.Minute,
+		RequestObjectSigner:   requestObjectKey,
+		LocalServerReadyChan:  openBrowserCh,
+		LocalServerMiddleware: loggingMiddleware(t),
+		Logf:                  t.Logf,
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL := <-openBrowserCh
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	if _, err := oauth2cli.GetToken(ctx, cfg); err != nil {
+		t.Errorf("could not get a token: %s", err)
+	}
+	wg.Wait()
+	q, _ := authorizationRequest.Load().(url.Values)
+	if want := "code"; q.Get("response_type") != want {
+		t.Errorf("response_type outside the request object wants %s but %s", want, q.Get("response_type"))
+	}
+	if want := "openid email"; q.Get("scope") != want {
+		t.Errorf("scope outside the request object wants %s but %s", want, q.Get("scope"))
+	}
+	if q.Has("nonce") || q.Has("max_age") {
+		t.Errorf("parameters except response_type and scope must be in the request object but %s", q.Encode())
+	}
+}
+
+func verifyES256(t *testing.T, token string, pub *ecdsa.PublicKey) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Errorf("token wants 3 parts but was %d", len(parts))
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		t.Errorf("invalid signature: %v", err)
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		t.Errorf("signature verification failed")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestJARM(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	key, jwks := newKeySet(t)
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		var testServer *httptest.Server
+		testServer = httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			JWKS:     jwks,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				if want := "query.jwt"; req.Raw.Get("response_mode") != want {
+					t.Errorf("response_mode wants %s but %s", want, req.Raw.Get("response_mode"))
+				}
+				response := signJWT(t, key, map[string]any{
+					"iss":   testServer.URL,
+					"aud":   "YOUR_CLIENT_ID",
+					"exp":   time.Now().Add(time.Minute).Unix(),
+					"state": req.State,
+					"code":  "AUTH_CODE",
+				})
+				return fmt.Sprintf("%s?response=%s", req.RedirectURI, response)
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				if want := "AUTH_CODE"; req.Code != want {
+					t.Errorf("code wants %s but %s", want, req.Code)
+					return 400, invalidGrantResponse
+				}
+				return 200, validTokenResponse
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			Issuer:                testServer.URL,
+			JWKSURL:               testServer.URL + "/jwks",
+			JARMResponseMode:      "query.jwt",
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		token, err := oauth2cli.GetToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+}
+
+func TestJARMPlainCodeResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	_, jwks := newKeySet(t)
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			JWKS:     jwks,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				return 500, "should not reach here"
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			Issuer:               testServer.URL,
+			JWKSURL:              testServer.URL + "/jwks",
+			JARMResponseMode:     "query.jwt",
+			LocalServerReadyChan: openBrowserCh,
+			Logf:                 t.Logf,
+		}
+		_, err := oauth2cli.GetToken(ctx, cfg)
+		if err == nil {
+			t.Errorf("GetToken wants error but was nil")
+			return
+		}
+		t.Logf("expected error: %s", err)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 500, "authorization error\n")
+	}()
+	wg.Wait()
+}
+
+func TestJARM_ContextClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	key, jwks := newKeySet(t)
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		JWKS:     jwks,
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			response := signJWT(t, key, map[string]any{
+				"iss":   testServer.URL,
+				"aud":   "YOUR_CLIENT_ID",
+				"exp":   time.Now().Add(time.Minute).Unix(),
+				"state": req.State,
+				"code":  "AUTH_CODE",
+			})
+			return fmt.Sprintf("%s?response=%s", req.RedirectURI, response)
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			return 200, validTokenResponse
+		},
+	})
+	defer testServer.Close()
+	ctx, backChannelURL := withBackChannelClient(ctx, testServer)
+	openBrowserCh := make(chan string)
+	defer close(openBrowserCh)
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID:     "YOUR_CLIENT_ID",
+			ClientSecret: "YOUR_CLIENT_SECRET",
+			Scopes:       []string{"email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  testServer.URL + "/auth",
+				TokenURL: backChannelURL + "/token",
+			},
+		},
+		Issuer: testServer.URL,
+		// The key set can be fetched only by the HTTP client of the context.
+		JWKSURL:               backChannelURL + "/jwks",
+		JARMResponseMode:      "query.jwt",
+		LocalServerReadyChan:  openBrowserCh,
+		LocalServerMiddleware: loggingMiddleware(t),
+		Logf:                  t.Logf,
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL := <-openBrowserCh
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	if _, err := oauth2cli.GetToken(ctx, cfg); err != nil {
+		t.Errorf("could not get a token: %s", err)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,186 @@
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestGetToken_LockFile(t *testing.T) {
+	var authorizationRequests atomic.Int32
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			authorizationRequests.Add(1)
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(authserver.TokenRequest) (int, string) {
+			return 200, validTokenResponse
+		},
+	})
+	defer testServer.Close()
+	newConfig := func(t *testing.T, dir string, openBrowserCh chan string) oauth2cli.Config {
+		return oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			TokenCache:            &oauth2cli.FileTokenCache{Dir: dir},
+			LockFile:              filepath.Join(dir, "lock"),
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+	}
+
+	concurrentLogins := func(t *testing.T, dir string) {
+		ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+		defer cancel()
+		authorizationRequests.Store(0)
+		openBrowserChs := []chan string{make(chan string), make(chan string)}
+		var logins sync.WaitGroup
+		for _, openBrowserCh := range openBrowserChs {
+			logins.Add(1)
+			go func() {
+				defer logins.Done()
+				token, err := oauth2cli.GetToken(ctx, newConfig(t, dir, openBrowserCh))
+				if err != nil {
+					t.Errorf("could not get a token: %s", err)
+					return
+				}
+				if want := "ACCESS_TOKEN"; token.AccessToken != want {
+					t.Errorf("AccessToken wants %s but %s", want, token.AccessToken)
+				}
+			}()
+		}
+		var browser sync.WaitGroup
+		browser.Add(1)
+		go func() {
+			defer browser.Done()
+			var toURL string
+			select {
+			case toURL = <-openBrowserChs[0]:
+			case toURL = <-openBrowserChs[1]:
+			case <-ctx.Done():
+				t.Errorf("browser was not opened: %s", ctx.Err())
+				return
+			}
+			client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+		}()
+		logins.Wait()
+		for _, openBrowserCh := range openBrowserChs {
+			close(openBrowserCh)
+		}
+		browser.Wait()
+		if n := authorizationRequests.Load(); n != 1 {
+			t.Errorf("authorization requests wants 1 but %d", n)
+		}
+	}
+
+	// holdLock starts a login which holds the lock until the returned function is called.
+	holdLock := func(t *testing.T, dir string) func() {
+		ctx, cancel := context.WithCancel(context.TODO())
+		openBrowserCh := make(chan string)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			// This returns an error on cancel.
+			_, _ = oauth2cli.GetToken(ctx, newConfig(t, dir, openBrowserCh))
+		}()
+		select {
+		case <-openBrowserCh:
+		case <-time.After(time.Second):
+			t.Fatalf("lock was not acquired")
+		}
+		return func() {
+			cancel()
+			<-done
+		}
+	}
+
+	t.Run("ConcurrentLogins", func(t *testing.T) {
+		concurrentLogins(t, t.TempDir())
+	})
+
+	t.Run("ConcurrentLoginsWithLeftLockFile", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "lock"), nil, 0600); err != nil {
+			t.Fatalf("could not write the lock file: %s", err)
+		}
+		concurrentLogins(t, dir)
+	})
+
+	t.Run("LockFileOfKilledProcess", func(t *testing.T) {
+		// The lock file of a killed process is left but not locked.
+		ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+		defer cancel()
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "lock"), []byte("KILLED_PROCESS"), 0600); err != nil {
+			t.Fatalf("could not write the lock file: %s", err)
+		}
+		openBrowserCh := make(chan string)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			toURL, ok := <-openBrowserCh
+			if !ok {
+				t.Errorf("server already closed")
+				return
+			}
+			client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+		}()
+		if _, err := oauth2cli.GetToken(ctx, newConfig(t, dir, openBrowserCh)); err != nil {
+			t.Errorf("could not get a token: %s", err)
+		}
+		close(openBrowserCh)
+		wg.Wait()
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		dir := t.TempDir()
+		defer holdLock(t, dir)()
+		cfg := newConfig(t, dir, nil)
+		cfg.LockTimeout = 300 * time.Millisecond
+		_, err := oauth2cli.GetToken(context.TODO(), cfg)
+		if !errors.Is(err, oauth2cli.ErrLockTimeout) {
+			t.Errorf("err wants ErrLockTimeout but was %v", err)
+		}
+	})
+
+	t.Run("WithoutTokenCache", func(t *testing.T) {
+		cfg := newConfig(t, t.TempDir(), nil)
+		cfg.TokenCache = nil
+		if _, err := oauth2cli.GetToken(context.TODO(), cfg); err == nil {
+			t.Errorf("GetToken wants an error but was nil")
+		}
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		dir := t.TempDir()
+		defer holdLock(t, dir)()
+		ctx, cancel := context.WithCancel(context.TODO())
+		time.AfterFunc(300*time.Millisecond, cancel)
+		_, err := oauth2cli.GetToken(ctx, newConfig(t, dir, nil))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err wants context.Canceled but was %v", err)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestLogout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and log out.
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewEndSessionResponse: func(req authserver.EndSessionRequest) string {
+				if want := "ID_TOKEN"; req.IDTokenHint != want {
+					t.Errorf("id_token_hint wants %s but %s", want, req.IDTokenHint)
+				}
+				if want := "YOUR_CLIENT_ID"; req.Raw.Get("client_id") != want {
+					t.Errorf("client_id wants %s but %s", want, req.Raw.Get("client_id"))
+				}
+				if !assertRedirectURI(t, req.PostLogoutRedirectURI, "http", "localhost", "/logout") {
+					return req.PostLogoutRedirectURI
+				}
+				return fmt.Sprintf("%s?state=%s", req.PostLogoutRedirectURI, req.State)
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID: "YOUR_CLIENT_ID",
+			},
+			EndSessionURL:           testServer.URL + "/logout",
+			LocalServerCallbackPath: "/logout",
+			LocalServerReadyChan:    openBrowserCh,
+			LocalServerMiddleware:   loggingMiddleware(t),
+			Logf:                    t.Logf,
+		}
+		if err := oauth2cli.Logout(ctx, cfg, "ID_TOKEN"); err != nil {
+			t.Errorf("could not log out: %s", err)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerLogoutHTML)
+	}()
+	wg.Wait()
+}
+
+func TestLogout_StateMismatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and log out.
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewEndSessionResponse: func(req authserver.EndSessionRequest) string {
+				return fmt.Sprintf("%s?state=%s", req.PostLogoutRedirectURI, "INVALID_STATE")
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID: "YOUR_CLIENT_ID",
+			},
+			EndSessionURL:         testServer.URL + "/logout",
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		if err := oauth2cli.Logout(ctx, cfg, "ID_TOKEN"); err == nil {
+			t.Errorf("Logout wants an error but was nil")
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 500, "logout error\n")
+	}()
+	wg.Wait()
+}
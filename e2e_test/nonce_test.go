@@ -0,0 +1,118 @@
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestNonce(t *testing.T) {
+	testNonce(t, func(nonce string) map[string]any {
+		return map[string]any{"sub": "USER_ID", "aud": "YOUR_CLIENT_ID", "nonce": nonce}
+	}, "")
+}
+
+func TestNonceMismatch(t *testing.T) {
+	testNonce(t, func(string) map[string]any {
+		return map[string]any{"sub": "USER_ID", "aud": "YOUR_CLIENT_ID", "nonce": "INVALID_NONCE"}
+	}, "nonce")
+}
+
+func TestNonce_AudienceMismatch(t *testing.T) {
+	// aud is verified even if Issuer and JWKSURL are not set.
+	testNonce(t, func(nonce string) map[string]any {
+		return map[string]any{"sub": "USER_ID", "aud": "ANOTHER_CLIENT_ID", "nonce": nonce}
+	}, "aud")
+}
+
+func TestNonce_AuthorizedPartyMismatch(t *testing.T) {
+	testNonce(t, func(nonce string) map[string]any {
+		return map[string]any{"sub": "USER_ID", "aud": []string{"YOUR_CLIENT_ID", "ANOTHER_CLIENT_ID"}, "azp": "ANOTHER_CLIENT_ID", "nonce": nonce}
+	}, "azp")
+}
+
+// testNonce tests the nonce parameter without Issuer and JWKSURL.
+// idTokenClaims returns the claims of the ID token for the nonce of the authorization request.
+func testNonce(t *testing.T, idTokenClaims func(nonce string) map[string]any, wantErrorClaim string) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	key, _ := newKeySet(t)
+	var nonce atomic.Value
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				if req.Raw.Get("nonce") == "" {
+					t.Errorf("nonce wants non-empty but was empty")
+				}
+				nonce.Store(req.Raw.Get("nonce"))
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				idToken := signJWT(t, key, idTokenClaims(nonce.Load().(string)))
+				return 200, fmt.Sprintf(`{"access_token":"ACCESS_TOKEN","token_type":"Bearer","expires_in":3600,"id_token":"%s"}`, idToken)
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"openid", "email"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		token, err := oauth2cli.GetToken(ctx, cfg)
+		if wantErrorClaim != "" {
+			var verificationErr *oauth2cli.IDTokenVerificationError
+			if !errors.As(err, &verificationErr) {
+				t.Errorf("err wants IDTokenVerificationError but was %v", err)
+				return
+			}
+			if verificationErr.Claim != wantErrorClaim {
+				t.Errorf("Claim wants %s but was %s", wantErrorClaim, verificationErr.Claim)
+			}
+			return
+		}
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,252 @@
+package e2e_test
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestGetTokenWithIDToken(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	key, jwks := newKeySet(t)
+	var nonce atomic.Value
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		var testServer *httptest.Server
+		testServer = httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			JWKS:     jwks,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				nonce.Store(req.Raw.Get("nonce"))
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				idToken := signJWT(t, key, map[string]any{
+					"iss":   testServer.URL,
+					"sub":   "USER_ID",
+					"aud":   "YOUR_CLIENT_ID",
+					"exp":   time.Now().Add(time.Hour).Unix(),
+					"iat":   time.Now().Unix(),
+					"nonce": nonce.Load(),
+					"email": "alice@example.com",
+				})
+				return 200, fmt.Sprintf(`{"access_token":"ACCESS_TOKEN","token_type":"Bearer","expires_in":3600,"id_token":"%s"}`, idToken)
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"openid", "email"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			Issuer:                testServer.URL,
+			JWKSURL:               testServer.URL + "/jwks",
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		token, idToken, err := oauth2cli.GetTokenWithIDToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+		}
+		if want := "USER_ID"; idToken.Subject != want {
+			t.Errorf("Subject wants %s but %s", want, idToken.Subject)
+		}
+		var claims struct {
+			Email string `json:"email"`
+		}
+		if err := idToken.Claims(&claims); err != nil {
+			t.Errorf("could not decode the claims: %s", err)
+		}
+		if want := "alice@example.com"; claims.Email != want {
+			t.Errorf("email wants %s but %s", want, claims.Email)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, jwks := newKeySet(t)
+	testServer := httptest.NewServer(&authserver.Handler{TestingT: t, JWKS: jwks})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{ClientID: "YOUR_CLIENT_ID"},
+		Issuer:       testServer.URL,
+		JWKSURL:      testServer.URL + "/jwks",
+		Logf:         t.Logf,
+	}
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"iss": testServer.URL,
+			"sub": "USER_ID",
+			"aud": "YOUR_CLIENT_ID",
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"iat": time.Now().Unix(),
+		}
+	}
+	for name, c := range map[string]struct {
+		modify    func(claims map[string]any)
+		wantClaim string
+	}{
+		"iss": {
+			modify:    func(claims map[string]any) { claims["iss"] = "https://attacker.example.com" },
+			wantClaim: "iss",
+		},
+		"aud": {
+			modify:    func(claims map[string]any) { claims["aud"] = "ANOTHER_CLIENT_ID" },
+			wantClaim: "aud",
+		},
+		"azp missing for multiple audiences": {
+			modify:    func(claims map[string]any) { claims["aud"] = []string{"YOUR_CLIENT_ID", "ANOTHER_CLIENT_ID"} },
+			wantClaim: "azp",
+		},
+		"azp": {
+			modify:    func(claims map[string]any) { claims["azp"] = "ANOTHER_CLIENT_ID" },
+			wantClaim: "azp",
+		},
+		"exp": {
+			modify:    func(claims map[string]any) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+			wantClaim: "exp",
+		},
+		"iat": {
+			modify:    func(claims map[string]any) { claims["iat"] = time.Now().Add(time.Hour).Unix() },
+			wantClaim: "iat",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			claims := validClaims()
+			c.modify(claims)
+			token := (&oauth2.Token{AccessToken: "ACCESS_TOKEN"}).WithExtra(map[string]any{
+				"id_token": signJWT(t, key, claims),
+			})
+			_, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, token)
+			var verificationErr *oauth2cli.IDTokenVerificationError
+			if !errors.As(err, &verificationErr) {
+				t.Fatalf("err wants IDTokenVerificationError but was %v", err)
+			}
+			if verificationErr.Claim != c.wantClaim {
+				t.Errorf("Claim wants %s but was %s: %s", c.wantClaim, verificationErr.Claim, err)
+			}
+		})
+	}
+	t.Run("missing", func(t *testing.T) {
+		_, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, &oauth2.Token{AccessToken: "ACCESS_TOKEN"})
+		var verificationErr *oauth2cli.IDTokenVerificationError
+		if !errors.As(err, &verificationErr) {
+			t.Errorf("err wants IDTokenVerificationError but was %v", err)
+		}
+	})
+	t.Run("invalid signature", func(t *testing.T) {
+		anotherKey, _ := newKeySet(t)
+		token := (&oauth2.Token{AccessToken: "ACCESS_TOKEN"}).WithExtra(map[string]any{
+			"id_token": signJWT(t, anotherKey, validClaims()),
+		})
+		_, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, token)
+		var verificationErr *oauth2cli.IDTokenVerificationError
+		if !errors.As(err, &verificationErr) {
+			t.Errorf("err wants IDTokenVerificationError but was %v", err)
+		}
+	})
+}
+
+func TestVerifyIDToken_KeyRotation(t *testing.T) {
+	oldKey, oldJWKS := newKeySetWithKeyID(t, "OLD_KEY_ID")
+	newKey, newJWKS := newKeySetWithKeyID(t, "NEW_KEY_ID")
+	var jwks atomic.Value
+	jwks.Store(oldJWKS)
+	var jwksRequests atomic.Int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwksRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, jwks.Load())
+	}))
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{ClientID: "YOUR_CLIENT_ID"},
+		Issuer:       testServer.URL,
+		JWKSURL:      testServer.URL + "/jwks",
+		Logf:         t.Logf,
+	}
+	newToken := func(key crypto.Signer, keyID string) *oauth2.Token {
+		claims := map[string]any{
+			"iss": testServer.URL,
+			"sub": "USER_ID",
+			"aud": "YOUR_CLIENT_ID",
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"iat": time.Now().Unix(),
+		}
+		return (&oauth2.Token{}).WithExtra(map[string]any{"id_token": signJWTWithKeyID(t, key, keyID, claims)})
+	}
+
+	if _, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, newToken(oldKey, "OLD_KEY_ID")); err != nil {
+		t.Fatalf("VerifyIDToken error: %s", err)
+	}
+	if _, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, newToken(oldKey, "OLD_KEY_ID")); err != nil {
+		t.Fatalf("VerifyIDToken error: %s", err)
+	}
+	if got := jwksRequests.Load(); got != 1 {
+		t.Errorf("key set must be cached but fetched %d times", got)
+	}
+
+	// An invalid signature of the known key does not fetch the key set.
+	if _, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, newToken(newKey, "OLD_KEY_ID")); err == nil {
+		t.Errorf("VerifyIDToken wants an error but was nil")
+	}
+	if got := jwksRequests.Load(); got != 1 {
+		t.Errorf("key set must not be fetched on an invalid signature but fetched %d times", got)
+	}
+
+	// The authorization server rotates the key.
+	jwks.Store(newJWKS)
+	if _, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, newToken(newKey, "NEW_KEY_ID")); err != nil {
+		t.Fatalf("VerifyIDToken error: %s", err)
+	}
+	if got := jwksRequests.Load(); got != 2 {
+		t.Errorf("key set must be fetched again but fetched %d times", got)
+	}
+
+	// An unknown key ID does not fetch the key set again within the interval.
+	if _, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, newToken(newKey, "UNKNOWN_KEY_ID")); err == nil {
+		t.Errorf("VerifyIDToken wants an error but was nil")
+	}
+	if got := jwksRequests.Load(); got != 2 {
+		t.Errorf("key set must be throttled but fetched %d times", got)
+	}
+}
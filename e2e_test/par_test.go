@@ -0,0 +1,217 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestPushedAuthorizationRequest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		authServer := &authserver.Handler{
+			TestingT: t,
+			NewPushedAuthorizationResponse: func(req authserver.PushedAuthorizationRequest) (int, string) {
+				if username, password, ok := (&http.Request{Header: req.Header}).BasicAuth(); !ok ||
+					username != "YOUR_CLIENT_ID" || password != "YOUR_CLIENT_SECRET" {
+					t.Errorf("client authentication wants basic auth but was %s", req.Header.Get("Authorization"))
+					return 401, `{"error":"invalid_client"}`
+				}
+				if want := "email profile"; req.Raw.Get("scope") != want {
+					t.Errorf("scope wants %s but %s", want, req.Raw.Get("scope"))
+				}
+				return 201, `{"request_uri":"urn:ietf:params:oauth:request_uri:REQUEST_URI","expires_in":60}`
+			},
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				if !assertRedirectURI(t, req.RedirectURI, "http", "localhost", "") {
+					return fmt.Sprintf("%s?error=invalid_redirect_uri", req.RedirectURI)
+				}
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				if want := "AUTH_CODE"; req.Code != want {
+					t.Errorf("code wants %s but %s", want, req.Code)
+					return 400, invalidGrantResponse
+				}
+				return 200, validTokenResponse
+			},
+		}
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/auth" {
+				q := r.URL.Query()
+				if len(q) != 2 || q.Get("client_id") != "YOUR_CLIENT_ID" || q.Get("request_uri") == "" {
+					t.Errorf("authorization request wants only client_id and request_uri but was %s", r.URL.RawQuery)
+				}
+			}
+			authServer.ServeHTTP(w, r)
+		}))
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			PushedAuthorizationRequestURL: testServer.URL + "/par",
+			LocalServerReadyChan:          openBrowserCh,
+			LocalServerMiddleware:         loggingMiddleware(t),
+			Logf:                          t.Logf,
+		}
+		token, err := oauth2cli.GetToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+}
+
+func TestPushedAuthorizationRequest_ContextClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewPushedAuthorizationResponse: func(req authserver.PushedAuthorizationRequest) (int, string) {
+			return 201, `{"request_uri":"urn:ietf:params:oauth:request_uri:REQUEST_URI","expires_in":60}`
+		},
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			return 200, validTokenResponse
+		},
+	})
+	defer testServer.Close()
+	ctx, backChannelURL := withBackChannelClient(ctx, testServer)
+	openBrowserCh := make(chan string)
+	defer close(openBrowserCh)
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID:     "YOUR_CLIENT_ID",
+			ClientSecret: "YOUR_CLIENT_SECRET",
+			Scopes:       []string{"email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  testServer.URL + "/auth",
+				TokenURL: backChannelURL + "/token",
+			},
+		},
+		// The PAR endpoint can be reached only by the HTTP client of the context.
+		PushedAuthorizationRequestURL: backChannelURL + "/par",
+		LocalServerReadyChan:          openBrowserCh,
+		LocalServerMiddleware:         loggingMiddleware(t),
+		Logf:                          t.Logf,
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL := <-openBrowserCh
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	if _, err := oauth2cli.GetToken(ctx, cfg); err != nil {
+		t.Errorf("could not get a token: %s", err)
+	}
+	wg.Wait()
+}
+
+func TestPushedAuthorizationRequest_Expired(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	var pushes atomic.Int32
+	var requestURI atomic.Value
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewPushedAuthorizationResponse: func(req authserver.PushedAuthorizationRequest) (int, string) {
+			n := pushes.Add(1)
+			// The request_uri expires before the browser is redirected.
+			return 201, fmt.Sprintf(`{"request_uri":"urn:ietf:params:oauth:request_uri:REQUEST_URI_%d","expires_in":1}`, n)
+		},
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			return 200, validTokenResponse
+		},
+	})
+	defer testServer.Close()
+	openBrowserCh := make(chan string)
+	defer close(openBrowserCh)
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID:     "YOUR_CLIENT_ID",
+			ClientSecret: "YOUR_CLIENT_SECRET",
+			Scopes:       []string{"email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  testServer.URL + "/auth",
+				TokenURL: testServer.URL + "/token",
+			},
+		},
+		PushedAuthorizationRequestURL: testServer.URL + "/par",
+		LocalServerReadyChan:          openBrowserCh,
+		LocalServerMiddleware:         loggingMiddleware(t),
+		Logf:                          t.Logf,
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL := <-openBrowserCh
+		// Open the local server without following the redirect, and then reload it.
+		noRedirectClient := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		resp, err := noRedirectClient.Get(toURL)
+		if err != nil {
+			t.Errorf("could not open the local server: %s", err)
+			return
+		}
+		_ = resp.Body.Close()
+		requestURI.Store(resp.Header.Get("Location"))
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	if _, err := oauth2cli.GetToken(ctx, cfg); err != nil {
+		t.Errorf("could not get a token: %s", err)
+	}
+	wg.Wait()
+	if n := pushes.Load(); n != 2 {
+		t.Errorf("pushed authorization requests wants 2 but %d", n)
+	}
+	if location, _ := requestURI.Load().(string); !strings.Contains(location, "REQUEST_URI_1") {
+		t.Errorf("first redirect wants REQUEST_URI_1 but was %s", location)
+	}
+}
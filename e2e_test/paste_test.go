@@ -0,0 +1,180 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"golang.org/x/oauth2"
+)
+
+func TestRedirectURLReader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	openBrowserCh := make(chan string)
+	pasteReader, pasteWriter := io.Pipe()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				if want := "AUTH_CODE"; req.Code != want {
+					t.Errorf("code wants %s but %s", want, req.Code)
+					return 400, invalidGrantResponse
+				}
+				return 200, validTokenResponse
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			RedirectURLReader:     pasteReader,
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		token, err := oauth2cli.GetToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+			return
+		}
+		if token.AccessToken != "ACCESS_TOKEN" {
+			t.Errorf("AccessToken wants %s but %s", "ACCESS_TOKEN", token.AccessToken)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer pasteWriter.Close()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		redirectURL := getRedirectURLWithoutCallback(t, toURL)
+		if redirectURL == "" {
+			return
+		}
+		// The user pastes the redirect URL, after an irrelevant line.
+		if _, err := fmt.Fprintf(pasteWriter, "\nhello\n%s\n", redirectURL); err != nil {
+			t.Errorf("could not write the redirect URL: %s", err)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestRedirectURLReader_StateMismatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	openBrowserCh := make(chan string)
+	pasteReader, pasteWriter := io.Pipe()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, "INVALID_STATE", "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				t.Errorf("token request must not be sent")
+				return 400, invalidGrantResponse
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			RedirectURLReader:     pasteReader,
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		_, err := oauth2cli.GetToken(ctx, cfg)
+		if err == nil {
+			t.Errorf("GetToken wants an error but was nil")
+			return
+		}
+		if !strings.Contains(err.Error(), "state does not match") {
+			t.Errorf("err wants state mismatch but was %s", err)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer pasteWriter.Close()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		redirectURL := getRedirectURLWithoutCallback(t, toURL)
+		if redirectURL == "" {
+			return
+		}
+		if _, err := fmt.Fprintln(pasteWriter, redirectURL); err != nil {
+			t.Errorf("could not write the redirect URL: %s", err)
+		}
+	}()
+	wg.Wait()
+}
+
+// getRedirectURLWithoutCallback follows the redirects from the local server to the authorization server,
+// and returns the redirect URL to the local server without sending it,
+// like a browser which cannot reach the local server.
+func getRedirectURLWithoutCallback(t *testing.T, toURL string) string {
+	hc := http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// The first redirect is to the authorization server.
+			// The second redirect is to the local server.
+			if len(via) >= 2 {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	resp, err := hc.Get(toURL)
+	if err != nil {
+		t.Errorf("could not send a request: %s", err)
+		return ""
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status wants %d but was %d", http.StatusFound, resp.StatusCode)
+		return ""
+	}
+	return resp.Header.Get("Location")
+}
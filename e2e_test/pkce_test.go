@@ -2,9 +2,12 @@ package e2e_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -102,3 +105,63 @@ func TestPKCE(t *testing.T) {
 	}()
 	wg.Wait()
 }
+
+func TestPKCE_GeneratedForEachFlow(t *testing.T) {
+	var codeChallenge atomic.Value
+	var codeChallenges []string
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			if req.Raw.Get("code_challenge_method") != "S256" {
+				t.Errorf("code_challenge_method wants S256 but was %s", req.Raw.Get("code_challenge_method"))
+			}
+			codeChallenge.Store(req.Raw.Get("code_challenge"))
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			hash := sha256.Sum256([]byte(req.Raw.Get("code_verifier")))
+			if got := base64.RawURLEncoding.EncodeToString(hash[:]); got != codeChallenge.Load() {
+				t.Errorf("code_verifier does not match the code_challenge %v", codeChallenge.Load())
+				return 400, invalidGrantResponse
+			}
+			return 200, validTokenResponse
+		},
+	})
+	defer testServer.Close()
+	openBrowserCh := make(chan string)
+	defer close(openBrowserCh)
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID:     "YOUR_CLIENT_ID",
+			ClientSecret: "YOUR_CLIENT_SECRET",
+			Scopes:       []string{"email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  testServer.URL + "/auth",
+				TokenURL: testServer.URL + "/token",
+			},
+		},
+		PKCE:                  true,
+		LocalServerReadyChan:  openBrowserCh,
+		LocalServerMiddleware: loggingMiddleware(t),
+		Logf:                  t.Logf,
+	}
+	for range 2 {
+		ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			toURL := <-openBrowserCh
+			client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+		}()
+		if _, err := oauth2cli.GetToken(ctx, cfg); err != nil {
+			t.Errorf("could not get a token: %s", err)
+		}
+		wg.Wait()
+		cancel()
+		codeChallenges = append(codeChallenges, codeChallenge.Load().(string))
+	}
+	if codeChallenges[0] == codeChallenges[1] {
+		t.Errorf("code_challenge wants different for each flow but was %s", codeChallenges[0])
+	}
+}
@@ -0,0 +1,214 @@
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestProfileStore(t *testing.T) {
+	store := &oauth2cli.ProfileStore{File: filepath.Join(t.TempDir(), "profiles.json")}
+	if profiles, err := store.List(); err != nil || len(profiles) != 0 {
+		t.Fatalf("List wants empty but was %+v, %v", profiles, err)
+	}
+	if err := store.Put(oauth2cli.Profile{Name: "personal", LoginHint: "alice@example.com"}); err != nil {
+		t.Fatalf("Put error: %s", err)
+	}
+	if err := store.Put(oauth2cli.Profile{Name: "admin", LoginHint: "alice-admin@example.com"}); err != nil {
+		t.Fatalf("Put error: %s", err)
+	}
+	profiles, err := store.List()
+	if err != nil {
+		t.Fatalf("List error: %s", err)
+	}
+	want := []oauth2cli.Profile{
+		{Name: "admin", LoginHint: "alice-admin@example.com"},
+		{Name: "personal", LoginHint: "alice@example.com"},
+	}
+	if diff := cmp.Diff(want, profiles); diff != "" {
+		t.Errorf("profiles mismatch (-want +got):\n%s", diff)
+	}
+	assertCurrentProfile(t, store, "personal")
+
+	if err := store.Switch("admin"); err != nil {
+		t.Fatalf("Switch error: %s", err)
+	}
+	assertCurrentProfile(t, store, "admin")
+	if err := store.Switch("unknown"); err == nil {
+		t.Errorf("Switch to unknown profile wants an error")
+	}
+
+	if err := store.Remove("admin"); err != nil {
+		t.Fatalf("Remove error: %s", err)
+	}
+	assertCurrentProfile(t, store, "")
+	if profile, err := store.Get("admin"); err != nil || profile != nil {
+		t.Errorf("Get of removed profile wants nil but was %+v, %v", profile, err)
+	}
+}
+
+func assertCurrentProfile(t *testing.T, store *oauth2cli.ProfileStore, want string) {
+	t.Helper()
+	current, err := store.Current()
+	if err != nil {
+		t.Fatalf("Current error: %s", err)
+	}
+	if current != want {
+		t.Errorf("current profile wants %q but %q", want, current)
+	}
+}
+
+func TestGetToken_Profile(t *testing.T) {
+	key, jwks := newKeySet(t)
+	var subject atomic.Value
+	subject.Store("ADMIN_ID")
+	var loginHint atomic.Value
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		JWKS:     jwks,
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			loginHint.Store(req.Raw.Get("login_hint"))
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(authserver.TokenRequest) (int, string) {
+			idToken := signJWT(t, key, map[string]any{
+				"iss":   testServer.URL,
+				"sub":   subject.Load(),
+				"aud":   "YOUR_CLIENT_ID",
+				"exp":   time.Now().Add(time.Hour).Unix(),
+				"iat":   time.Now().Unix(),
+				"email": "alice-admin@example.com",
+			})
+			return 200, fmt.Sprintf(`{"access_token":"ACCESS_TOKEN","token_type":"Bearer","expires_in":3600,"id_token":%q}`, idToken)
+		},
+	})
+	defer testServer.Close()
+	dir := t.TempDir()
+	store := &oauth2cli.ProfileStore{File: filepath.Join(dir, "profiles.json")}
+	if err := store.Put(oauth2cli.Profile{Name: "admin", LoginHint: "alice-admin@example.com"}); err != nil {
+		t.Fatalf("Put error: %s", err)
+	}
+	cache := &oauth2cli.FileTokenCache{Dir: dir}
+	newConfig := func(t *testing.T, openBrowserCh chan<- string) oauth2cli.Config {
+		return oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			Issuer:                testServer.URL,
+			JWKSURL:               testServer.URL + "/jwks",
+			TokenCache:            cache,
+			ProfileStore:          store,
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+	}
+	login := func(t *testing.T, cfg oauth2cli.Config, openBrowserCh chan string) error {
+		ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+		defer cancel()
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			toURL, ok := <-openBrowserCh
+			if !ok {
+				t.Errorf("server already closed")
+				return
+			}
+			client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+		}()
+		_, err := oauth2cli.GetToken(ctx, cfg)
+		close(openBrowserCh)
+		wg.Wait()
+		return err
+	}
+
+	t.Run("FirstLogin", func(t *testing.T) {
+		// The current profile is used if Profile is not set.
+		openBrowserCh := make(chan string)
+		if err := login(t, newConfig(t, openBrowserCh), openBrowserCh); err != nil {
+			t.Fatalf("could not get a token: %s", err)
+		}
+		if want := "alice-admin@example.com"; loginHint.Load() != want {
+			t.Errorf("login_hint wants %s but %v", want, loginHint.Load())
+		}
+		profile, err := store.Get("admin")
+		if err != nil {
+			t.Fatalf("Get error: %s", err)
+		}
+		want := &oauth2cli.Profile{Name: "admin", LoginHint: "alice-admin@example.com", Subject: "ADMIN_ID", Email: "alice-admin@example.com"}
+		if diff := cmp.Diff(want, profile); diff != "" {
+			t.Errorf("profile mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("CachedForEachProfile", func(t *testing.T) {
+		cfg := newConfig(t, nil)
+		cfg.Profile = "admin"
+		if _, err := oauth2cli.GetToken(context.TODO(), cfg); err != nil {
+			t.Fatalf("could not get the cached token: %s", err)
+		}
+		cfg.Profile = "personal"
+		if token, err := cache.Load(oauth2cli.TokenCacheKeyOf(cfg)); err != nil || token != nil {
+			t.Errorf("token of another profile wants nil but was %+v, %v", token, err)
+		}
+	})
+
+	t.Run("AccountMismatchFail", func(t *testing.T) {
+		if err := oauth2cli.RemoveProfile(newConfig(t, nil), "admin"); err != nil {
+			t.Fatalf("RemoveProfile error: %s", err)
+		}
+		if err := store.Put(oauth2cli.Profile{Name: "admin", Subject: "ADMIN_ID"}); err != nil {
+			t.Fatalf("Put error: %s", err)
+		}
+		subject.Store("PERSONAL_ID")
+		openBrowserCh := make(chan string)
+		cfg := newConfig(t, openBrowserCh)
+		cfg.Profile = "admin"
+		if err := login(t, cfg, openBrowserCh); !errors.Is(err, oauth2cli.ErrAccountMismatch) {
+			t.Errorf("err wants ErrAccountMismatch but was %v", err)
+		}
+		if token, err := cache.Load(oauth2cli.TokenCacheKeyOf(cfg)); err != nil || token != nil {
+			t.Errorf("token of another account wants not cached but was %+v, %v", token, err)
+		}
+	})
+
+	t.Run("AccountMismatchWarn", func(t *testing.T) {
+		openBrowserCh := make(chan string)
+		cfg := newConfig(t, openBrowserCh)
+		cfg.Profile = "admin"
+		cfg.AccountMismatchPolicy = oauth2cli.AccountMismatchWarn
+		if err := login(t, cfg, openBrowserCh); err != nil {
+			t.Errorf("could not get a token: %s", err)
+		}
+		profile, err := store.Get("admin")
+		if err != nil {
+			t.Fatalf("Get error: %s", err)
+		}
+		if want := "ADMIN_ID"; profile.Subject != want {
+			t.Errorf("Subject wants %s but %s", want, profile.Subject)
+		}
+		if token, err := cache.Load(oauth2cli.TokenCacheKeyOf(cfg)); err != nil || token != nil {
+			t.Errorf("token of another account wants not cached but was %+v, %v", token, err)
+		}
+	})
+}
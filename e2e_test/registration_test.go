@@ -0,0 +1,143 @@
+package e2e_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"golang.org/x/oauth2"
+)
+
+func TestClientRegistration(t *testing.T) {
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewRegistrationResponse: func(req authserver.RegistrationRequest) (int, string) {
+			switch {
+			case req.Method == "POST" && req.Path == "/register":
+				if want := "Bearer INITIAL_ACCESS_TOKEN"; req.Header.Get("Authorization") != want {
+					t.Errorf("Authorization wants %s but %s", want, req.Header.Get("Authorization"))
+				}
+				var metadata oauth2cli.ClientMetadata
+				if err := json.Unmarshal([]byte(req.Body), &metadata); err != nil {
+					t.Errorf("invalid request body: %s", err)
+					return 400, `{"error":"invalid_client_metadata"}`
+				}
+				if want := []string{"http://localhost/callback"}; !cmp.Equal(want, metadata.RedirectURIs) {
+					t.Errorf("redirect_uris mismatch (-want +got):\n%s", cmp.Diff(want, metadata.RedirectURIs))
+					return 400, `{"error":"invalid_redirect_uri"}`
+				}
+				return 201, fmt.Sprintf(`{
+					"client_id": "CLIENT_ID",
+					"registration_access_token": "REGISTRATION_ACCESS_TOKEN",
+					"registration_client_uri": "%s/register/CLIENT_ID",
+					"token_endpoint_auth_method": "none",
+					"redirect_uris": ["http://localhost/callback"],
+					"client_name": "%s"
+				}`, testServer.URL, metadata.ClientName)
+			case req.Method == "GET" && req.Path == "/register/CLIENT_ID":
+				if want := "Bearer REGISTRATION_ACCESS_TOKEN"; req.Header.Get("Authorization") != want {
+					t.Errorf("Authorization wants %s but %s", want, req.Header.Get("Authorization"))
+					return 401, `{"error":"invalid_token"}`
+				}
+				return 200, `{"client_id": "CLIENT_ID", "client_name": "example"}`
+			case req.Method == "PUT" && req.Path == "/register/CLIENT_ID":
+				var body map[string]any
+				if err := json.Unmarshal([]byte(req.Body), &body); err != nil {
+					t.Errorf("invalid request body: %s", err)
+				}
+				if want := "CLIENT_ID"; body["client_id"] != want {
+					t.Errorf("client_id wants %s but %v", want, body["client_id"])
+				}
+				return 200, `{"client_id": "CLIENT_ID", "client_name": "updated", "registration_access_token": "NEW_TOKEN"}`
+			}
+			return 404, `{"error":"not_found"}`
+		},
+	})
+	defer testServer.Close()
+	ctx := context.TODO()
+
+	cfg := oauth2cli.Config{LocalServerCallbackPath: "/callback", RegistrationURL: testServer.URL + "/register"}
+	registration, err := oauth2cli.RegisterClient(ctx, cfg,
+		oauth2cli.NewNativeClientMetadata(cfg, "example"), "INITIAL_ACCESS_TOKEN")
+	if err != nil {
+		t.Fatalf("RegisterClient error: %s", err)
+	}
+	registration.Configure(&cfg)
+	if want := "CLIENT_ID"; cfg.OAuth2Config.ClientID != want {
+		t.Errorf("ClientID wants %s but %s", want, cfg.OAuth2Config.ClientID)
+	}
+	if cfg.OAuth2Config.Endpoint.AuthStyle != oauth2.AuthStyleInParams {
+		t.Errorf("AuthStyle wants AuthStyleInParams but %v", cfg.OAuth2Config.Endpoint.AuthStyle)
+	}
+
+	name := filepath.Join(t.TempDir(), "registration.json")
+	if err := oauth2cli.SaveClientRegistration(name, registration); err != nil {
+		t.Fatalf("SaveClientRegistration error: %s", err)
+	}
+	loaded, err := oauth2cli.LoadClientRegistration(name)
+	if err != nil {
+		t.Fatalf("LoadClientRegistration error: %s", err)
+	}
+	if diff := cmp.Diff(registration, loaded); diff != "" {
+		t.Errorf("registration mismatch (-want +got):\n%s", diff)
+	}
+
+	read, err := oauth2cli.ReadClientRegistration(ctx, loaded)
+	if err != nil {
+		t.Fatalf("ReadClientRegistration error: %s", err)
+	}
+	if want := "REGISTRATION_ACCESS_TOKEN"; read.RegistrationAccessToken != want {
+		t.Errorf("RegistrationAccessToken wants %s but %s", want, read.RegistrationAccessToken)
+	}
+
+	metadata := read.ClientMetadata
+	metadata.ClientName = "updated"
+	updated, err := oauth2cli.UpdateClientRegistration(ctx, read, metadata)
+	if err != nil {
+		t.Fatalf("UpdateClientRegistration error: %s", err)
+	}
+	if want := "NEW_TOKEN"; updated.RegistrationAccessToken != want {
+		t.Errorf("RegistrationAccessToken wants %s but %s", want, updated.RegistrationAccessToken)
+	}
+	if want := "updated"; updated.ClientName != want {
+		t.Errorf("ClientName wants %s but %s", want, updated.ClientName)
+	}
+}
+
+func TestClientRegistration_Error(t *testing.T) {
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewRegistrationResponse: func(req authserver.RegistrationRequest) (int, string) {
+			return 400, `{"error":"invalid_redirect_uri","error_description":"not allowed"}`
+		},
+	})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{RegistrationURL: testServer.URL + "/register"}
+	_, err := oauth2cli.RegisterClient(context.TODO(), cfg, oauth2cli.ClientMetadata{}, "")
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		t.Fatalf("err wants RetrieveError but was %v", err)
+	}
+	if want := "invalid_redirect_uri"; retrieveErr.ErrorCode != want {
+		t.Errorf("ErrorCode wants %s but %s", want, retrieveErr.ErrorCode)
+	}
+}
+
+func TestLoopbackRedirectURIs(t *testing.T) {
+	got := oauth2cli.LoopbackRedirectURIs(oauth2cli.Config{
+		LocalServerBindAddress:  []string{"127.0.0.1:8000", "127.0.0.1:18000", "127.0.0.1:0"},
+		LocalServerCallbackPath: "/callback",
+	})
+	want := []string{"http://localhost:8000/callback", "http://localhost:18000/callback", "http://localhost/callback"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
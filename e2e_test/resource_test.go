@@ -0,0 +1,108 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestResourceIndicators(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	resources := []string{"https://api1.example.com", "https://api2.example.com"}
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			if diff := cmp.Diff(resources, req.Raw["resource"]); diff != "" {
+				t.Errorf("resource mismatch (-want +got):\n%s", diff)
+			}
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			switch req.GrantType {
+			case "authorization_code":
+				if req.Raw.Has("resource") {
+					t.Errorf("resource wants none but %s", req.Raw["resource"])
+				}
+				return 200, `{"access_token":"ACCESS_TOKEN","token_type":"Bearer","expires_in":3600,"refresh_token":"REFRESH_TOKEN_0"}`
+			case "refresh_token":
+				switch resource, refreshToken := req.Raw.Get("resource"), req.Raw.Get("refresh_token"); {
+				case resource == resources[0] && refreshToken == "REFRESH_TOKEN_0":
+					return 200, `{"access_token":"ACCESS_TOKEN_1","token_type":"Bearer","expires_in":3600,"refresh_token":"REFRESH_TOKEN_1"}`
+				case resource == resources[1] && refreshToken == "REFRESH_TOKEN_1":
+					return 200, `{"access_token":"ACCESS_TOKEN_2","token_type":"Bearer","expires_in":3600}`
+				}
+				t.Errorf("unexpected refresh token request: %s", req.Raw.Encode())
+			}
+			return 400, invalidGrantResponse
+		},
+	})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID:     "YOUR_CLIENT_ID",
+			ClientSecret: "YOUR_CLIENT_SECRET",
+			Scopes:       []string{"email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  testServer.URL + "/auth",
+				TokenURL: testServer.URL + "/token",
+			},
+		},
+		Resources:             resources,
+		LocalServerMiddleware: loggingMiddleware(t),
+		Logf:                  t.Logf,
+	}
+	openBrowserCh := make(chan string)
+	cfg.LocalServerReadyChan = openBrowserCh
+	var token *oauth2.Token
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		var err error
+		token, err = oauth2cli.GetToken(ctx, cfg)
+		if err != nil {
+			t.Errorf("could not get a token: %s", err)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+	if token == nil {
+		return
+	}
+
+	tokens, err := oauth2cli.GetTokensForResources(ctx, cfg, token)
+	if err != nil {
+		t.Fatalf("GetTokensForResources: %s", err)
+	}
+	for resource, want := range map[string]string{
+		resources[0]: "ACCESS_TOKEN_1",
+		resources[1]: "ACCESS_TOKEN_2",
+	} {
+		if got := tokens[resource]; got == nil || got.AccessToken != want {
+			t.Errorf("token of %s wants %s but %+v", resource, want, got)
+		}
+	}
+	if got := tokens[resources[1]].RefreshToken; got != "REFRESH_TOKEN_1" {
+		t.Errorf("RefreshToken wants REFRESH_TOKEN_1 but %s", got)
+	}
+}
@@ -0,0 +1,76 @@
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"golang.org/x/oauth2"
+)
+
+func TestRevokeToken(t *testing.T) {
+	var mu sync.Mutex
+	var revoked []string
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewRevocationResponse: func(req authserver.RevocationRequest) (int, string) {
+			if username, password, ok := (&http.Request{Header: req.Header}).BasicAuth(); !ok ||
+				username != "YOUR_CLIENT_ID" || password != "YOUR_CLIENT_SECRET" {
+				t.Errorf("client authentication wants basic auth but was %s", req.Header.Get("Authorization"))
+				return 401, `{"error":"invalid_client"}`
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			revoked = append(revoked, req.TokenTypeHint+"="+req.Token)
+			return 200, `{}`
+		},
+	})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{
+			ClientID:     "YOUR_CLIENT_ID",
+			ClientSecret: "YOUR_CLIENT_SECRET",
+		},
+		RevocationURL: testServer.URL + "/revoke",
+	}
+	token := &oauth2.Token{AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"}
+	if err := oauth2cli.RevokeToken(context.TODO(), cfg, token); err != nil {
+		t.Fatalf("RevokeToken error: %s", err)
+	}
+	want := []string{"refresh_token=REFRESH_TOKEN", "access_token=ACCESS_TOKEN"}
+	if diff := cmp.Diff(want, revoked); diff != "" {
+		t.Errorf("revoked mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRevokeToken_UnsupportedTokenType(t *testing.T) {
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewRevocationResponse: func(req authserver.RevocationRequest) (int, string) {
+			if req.TokenTypeHint == "access_token" {
+				return 400, `{"error":"unsupported_token_type"}`
+			}
+			return 200, `{}`
+		},
+	})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config:  oauth2.Config{ClientID: "YOUR_CLIENT_ID", Endpoint: oauth2.Endpoint{AuthStyle: oauth2.AuthStyleInParams}},
+		RevocationURL: testServer.URL + "/revoke",
+	}
+	token := &oauth2.Token{AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"}
+	err := oauth2cli.RevokeToken(context.TODO(), cfg, token)
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		t.Fatalf("err wants RetrieveError but was %v", err)
+	}
+	if want := "unsupported_token_type"; retrieveErr.ErrorCode != want {
+		t.Errorf("ErrorCode wants %s but %s", want, retrieveErr.ErrorCode)
+	}
+}
@@ -0,0 +1,161 @@
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestMaxAgeAndACRValues(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	key, _ := newKeySet(t)
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(openBrowserCh)
+		// Start a local server and get a token.
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				if want := "300"; req.Raw.Get("max_age") != want {
+					t.Errorf("max_age wants %s but %s", want, req.Raw.Get("max_age"))
+				}
+				if want := "mfa phr"; req.Raw.Get("acr_values") != want {
+					t.Errorf("acr_values wants %s but %s", want, req.Raw.Get("acr_values"))
+				}
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				idToken := signJWT(t, key, map[string]any{
+					"sub":       "USER_ID",
+					"aud":       "YOUR_CLIENT_ID",
+					"auth_time": time.Now().Add(-10 * time.Minute).Unix(),
+					"acr":       "mfa",
+				})
+				return 200, fmt.Sprintf(`{"access_token":"ACCESS_TOKEN","token_type":"Bearer","expires_in":3600,"id_token":"%s"}`, idToken)
+			},
+		})
+		defer testServer.Close()
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			MaxAge:                5 * time.Minute,
+			ACRValues:             []string{"mfa", "phr"},
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+		_, err := oauth2cli.GetToken(ctx, cfg)
+		var authTimeErr *oauth2cli.AuthTimeError
+		if !errors.As(err, &authTimeErr) {
+			t.Errorf("err wants AuthTimeError but was %v", err)
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	wg.Wait()
+}
+
+func TestVerifyIDToken_AuthTimeAndACR(t *testing.T) {
+	key, jwks := newKeySet(t)
+	testServer := httptest.NewServer(&authserver.Handler{TestingT: t, JWKS: jwks})
+	defer testServer.Close()
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{ClientID: "YOUR_CLIENT_ID"},
+		Issuer:       testServer.URL,
+		JWKSURL:      testServer.URL + "/jwks",
+		MaxAge:       5 * time.Minute,
+		ACRValues:    []string{"mfa"},
+		Logf:         t.Logf,
+	}
+	newToken := func(authTime time.Time, acr string) *oauth2.Token {
+		claims := map[string]any{
+			"iss": testServer.URL,
+			"sub": "USER_ID",
+			"aud": "YOUR_CLIENT_ID",
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"iat": time.Now().Unix(),
+			"acr": acr,
+		}
+		if !authTime.IsZero() {
+			claims["auth_time"] = authTime.Unix()
+		}
+		return (&oauth2.Token{AccessToken: "ACCESS_TOKEN"}).WithExtra(map[string]any{"id_token": signJWT(t, key, claims)})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		idToken, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, newToken(time.Now().Add(-time.Minute), "mfa"))
+		if err != nil {
+			t.Fatalf("VerifyIDToken error: %s", err)
+		}
+		if want := "mfa"; idToken.ACR != want {
+			t.Errorf("ACR wants %s but %s", want, idToken.ACR)
+		}
+	})
+	t.Run("auth_time is too old", func(t *testing.T) {
+		_, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, newToken(time.Now().Add(-10*time.Minute), "mfa"))
+		var authTimeErr *oauth2cli.AuthTimeError
+		if !errors.As(err, &authTimeErr) {
+			t.Fatalf("err wants AuthTimeError but was %v", err)
+		}
+		if authTimeErr.AuthTime.IsZero() {
+			t.Errorf("AuthTime wants non-zero")
+		}
+	})
+	t.Run("auth_time is missing", func(t *testing.T) {
+		_, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, newToken(time.Time{}, "mfa"))
+		var authTimeErr *oauth2cli.AuthTimeError
+		if !errors.As(err, &authTimeErr) {
+			t.Errorf("err wants AuthTimeError but was %v", err)
+		}
+	})
+	t.Run("acr", func(t *testing.T) {
+		_, err := oauth2cli.VerifyIDToken(context.TODO(), cfg, newToken(time.Now(), "pwd"))
+		var acrErr *oauth2cli.ACRError
+		if !errors.As(err, &acrErr) {
+			t.Fatalf("err wants ACRError but was %v", err)
+		}
+		if want := "pwd"; acrErr.ACR != want {
+			t.Errorf("ACR wants %s but %s", want, acrErr.ACR)
+		}
+	})
+}
+
+func TestGetToken_InvalidMaxAge(t *testing.T) {
+	for _, maxAge := range []time.Duration{500 * time.Millisecond, 1500 * time.Millisecond, -time.Minute} {
+		cfg := oauth2cli.Config{
+			OAuth2Config: oauth2.Config{ClientID: "YOUR_CLIENT_ID"},
+			MaxAge:       maxAge,
+		}
+		if _, err := oauth2cli.GetToken(context.TODO(), cfg); err == nil {
+			t.Errorf("GetToken with MaxAge %s wants an error but was nil", maxAge)
+		}
+	}
+}
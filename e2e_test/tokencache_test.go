@@ -0,0 +1,303 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestFileTokenCache(t *testing.T) {
+	cache := &oauth2cli.FileTokenCache{Dir: filepath.Join(t.TempDir(), "tokens")}
+	key := oauth2cli.TokenCacheKey{Issuer: "https://issuer.example.com", ClientID: "YOUR_CLIENT_ID", Scopes: []string{"openid"}}
+	token, err := cache.Load(key)
+	if err != nil {
+		t.Fatalf("Load error: %s", err)
+	}
+	if token != nil {
+		t.Errorf("token wants nil but was %+v", token)
+	}
+
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	if err := cache.Save(key, (&oauth2.Token{
+		AccessToken:  "ACCESS_TOKEN",
+		TokenType:    "Bearer",
+		RefreshToken: "REFRESH_TOKEN",
+		Expiry:       expiry,
+	}).WithExtra(map[string]any{
+		"id_token":    "ID_TOKEN",
+		"scope":       "openid email",
+		"unknown_key": "UNKNOWN_VALUE",
+	})); err != nil {
+		t.Fatalf("Save error: %s", err)
+	}
+	entries, err := os.ReadDir(cache.Dir)
+	if err != nil {
+		t.Fatalf("ReadDir error: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("files wants 1 but %d", len(entries))
+	}
+	info, err := entries[0].Info()
+	if err != nil {
+		t.Fatalf("Info error: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("permission wants 0600 but %o", info.Mode().Perm())
+	}
+
+	token, err = cache.Load(key)
+	if err != nil {
+		t.Fatalf("Load error: %s", err)
+	}
+	if token.AccessToken != "ACCESS_TOKEN" || token.RefreshToken != "REFRESH_TOKEN" || !token.Expiry.Equal(expiry) {
+		t.Errorf("token mismatch: %+v", token)
+	}
+	if want := "ID_TOKEN"; token.Extra("id_token") != want {
+		t.Errorf("id_token wants %s but %v", want, token.Extra("id_token"))
+	}
+	if want := "openid email"; token.Extra("scope") != want {
+		t.Errorf("scope wants %s but %v", want, token.Extra("scope"))
+	}
+	if token.Extra("unknown_key") != nil {
+		t.Errorf("unknown_key wants nil but %v", token.Extra("unknown_key"))
+	}
+
+	anotherKey := key
+	anotherKey.Scopes = []string{"openid", "email"}
+	if token, err := cache.Load(anotherKey); err != nil || token != nil {
+		t.Errorf("Load of another key wants nil but was %+v, %v", token, err)
+	}
+
+	if err := cache.Delete(key); err != nil {
+		t.Fatalf("Delete error: %s", err)
+	}
+	if token, err := cache.Load(key); err != nil || token != nil {
+		t.Errorf("Load after Delete wants nil but was %+v, %v", token, err)
+	}
+	if err := cache.Delete(key); err != nil {
+		t.Errorf("Delete of a missing token wants no error but was %s", err)
+	}
+}
+
+func TestGetToken_TokenCache(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	var tokenRequests int
+	testServer := httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+			tokenRequests++
+			return 200, validTokenResponse
+		},
+	})
+	defer testServer.Close()
+	cache := &oauth2cli.FileTokenCache{Dir: t.TempDir()}
+	newConfig := func(openBrowserCh chan string) oauth2cli.Config {
+		return oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"profile", "email"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			TokenCache:            cache,
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+	}
+
+	// The first call starts the local server and saves the token.
+	openBrowserCh := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		toURL, ok := <-openBrowserCh
+		if !ok {
+			t.Errorf("server already closed")
+			return
+		}
+		client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+	}()
+	if _, err := oauth2cli.GetToken(ctx, newConfig(openBrowserCh)); err != nil {
+		t.Fatalf("could not get a token: %s", err)
+	}
+	close(openBrowserCh)
+	wg.Wait()
+
+	// The second call returns the cached token without the local server.
+	// The order of the scopes does not matter.
+	cfg := newConfig(nil)
+	cfg.OAuth2Config.Scopes = []string{"email", "profile"}
+	token, err := oauth2cli.GetToken(ctx, cfg)
+	if err != nil {
+		t.Fatalf("could not get a token: %s", err)
+	}
+	if want := "ACCESS_TOKEN"; token.AccessToken != want {
+		t.Errorf("AccessToken wants %s but %s", want, token.AccessToken)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("token requests wants 1 but %d", tokenRequests)
+	}
+}
+
+func TestTokenCacheKeyOf(t *testing.T) {
+	cfg := oauth2cli.Config{
+		OAuth2Config: oauth2.Config{ClientID: "YOUR_CLIENT_ID", Scopes: []string{"email"}},
+		Issuer:       "https://issuer.example.com",
+		Resources:    []string{"https://api.example.com"},
+	}
+	anotherResource := cfg
+	anotherResource.Resources = []string{"https://admin.example.com"}
+	if cmp.Equal(oauth2cli.TokenCacheKeyOf(cfg), oauth2cli.TokenCacheKeyOf(anotherResource)) {
+		t.Errorf("key of another resource wants different")
+	}
+	anotherParameter := cfg
+	anotherParameter.AuthCodeOptions = []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("audience", "admin")}
+	if cmp.Equal(oauth2cli.TokenCacheKeyOf(cfg), oauth2cli.TokenCacheKeyOf(anotherParameter)) {
+		t.Errorf("key of another authorization parameter wants different")
+	}
+	perRequest := cfg
+	perRequest.AuthCodeOptions = []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(oauth2.GenerateVerifier())}
+	if diff := cmp.Diff(oauth2cli.TokenCacheKeyOf(cfg), oauth2cli.TokenCacheKeyOf(perRequest)); diff != "" {
+		t.Errorf("key of a per-request parameter wants same (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetToken_TokenCache_IDTokenVerification(t *testing.T) {
+	key, jwks := newKeySet(t)
+	var authorizationRequests atomic.Int32
+	var testServer *httptest.Server
+	testServer = httptest.NewServer(&authserver.Handler{
+		TestingT: t,
+		JWKS:     jwks,
+		NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+			authorizationRequests.Add(1)
+			return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+		},
+		NewTokenResponse: func(authserver.TokenRequest) (int, string) {
+			idToken := signJWT(t, key, map[string]any{
+				"iss":       testServer.URL,
+				"sub":       "USER_ID",
+				"aud":       "YOUR_CLIENT_ID",
+				"exp":       time.Now().Add(time.Hour).Unix(),
+				"iat":       time.Now().Unix(),
+				"auth_time": time.Now().Unix(),
+				"acr":       "mfa",
+			})
+			return 200, fmt.Sprintf(`{"access_token":"NEW_ACCESS_TOKEN","token_type":"Bearer","expires_in":3600,"id_token":%q}`, idToken)
+		},
+	})
+	defer testServer.Close()
+	newCachedToken := func(idTokenExpiry time.Time, acr string) *oauth2.Token {
+		idToken := signJWT(t, key, map[string]any{
+			"iss":       testServer.URL,
+			"sub":       "USER_ID",
+			"aud":       "YOUR_CLIENT_ID",
+			"exp":       idTokenExpiry.Unix(),
+			"iat":       time.Now().Add(-2 * time.Hour).Unix(),
+			"auth_time": time.Now().Add(-2 * time.Hour).Unix(),
+			"acr":       acr,
+		})
+		return (&oauth2.Token{AccessToken: "OLD_ACCESS_TOKEN", Expiry: time.Now().Add(time.Hour)}).
+			WithExtra(map[string]any{"id_token": idToken})
+	}
+	login := func(t *testing.T, cfg oauth2cli.Config, openBrowserCh chan string,
+		getToken func(context.Context, oauth2cli.Config) (*oauth2.Token, error)) *oauth2.Token {
+		ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+		defer cancel()
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			toURL, ok := <-openBrowserCh
+			if !ok {
+				t.Errorf("server already closed")
+				return
+			}
+			client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+		}()
+		token, err := getToken(ctx, cfg)
+		close(openBrowserCh)
+		wg.Wait()
+		if err != nil {
+			t.Fatalf("could not get a token: %s", err)
+		}
+		return token
+	}
+	newConfig := func(t *testing.T, openBrowserCh chan<- string) oauth2cli.Config {
+		return oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServer.URL + "/auth",
+					TokenURL: testServer.URL + "/token",
+				},
+			},
+			TokenCache:            &oauth2cli.FileTokenCache{Dir: t.TempDir()},
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+	}
+
+	t.Run("StepUp", func(t *testing.T) {
+		authorizationRequests.Store(0)
+		openBrowserCh := make(chan string)
+		cfg := newConfig(t, openBrowserCh)
+		cfg.MaxAge = 5 * time.Minute
+		cfg.ACRValues = []string{"mfa"}
+		if err := cfg.TokenCache.Save(oauth2cli.TokenCacheKeyOf(cfg), newCachedToken(time.Now().Add(time.Hour), "pwd")); err != nil {
+			t.Fatalf("Save error: %s", err)
+		}
+		token := login(t, cfg, openBrowserCh, oauth2cli.GetToken)
+		if want := "NEW_ACCESS_TOKEN"; token.AccessToken != want {
+			t.Errorf("AccessToken wants %s but %s", want, token.AccessToken)
+		}
+		if n := authorizationRequests.Load(); n != 1 {
+			t.Errorf("authorization requests wants 1 but %d", n)
+		}
+	})
+
+	t.Run("ExpiredIDToken", func(t *testing.T) {
+		authorizationRequests.Store(0)
+		openBrowserCh := make(chan string)
+		cfg := newConfig(t, openBrowserCh)
+		cfg.Issuer = testServer.URL
+		cfg.JWKSURL = testServer.URL + "/jwks"
+		if err := cfg.TokenCache.Save(oauth2cli.TokenCacheKeyOf(cfg), newCachedToken(time.Now().Add(-time.Hour), "mfa")); err != nil {
+			t.Fatalf("Save error: %s", err)
+		}
+		token := login(t, cfg, openBrowserCh, func(ctx context.Context, cfg oauth2cli.Config) (*oauth2.Token, error) {
+			token, _, err := oauth2cli.GetTokenWithIDToken(ctx, cfg)
+			return token, err
+		})
+		if want := "NEW_ACCESS_TOKEN"; token.AccessToken != want {
+			t.Errorf("AccessToken wants %s but %s", want, token.AccessToken)
+		}
+		if n := authorizationRequests.Load(); n != 1 {
+			t.Errorf("authorization requests wants 1 but %d", n)
+		}
+	})
+}
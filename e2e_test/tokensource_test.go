@@ -0,0 +1,214 @@
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"github.com/int128/oauth2cli/e2e_test/client"
+	"golang.org/x/oauth2"
+)
+
+func TestNewTokenSource(t *testing.T) {
+	expiredToken := &oauth2.Token{
+		AccessToken:  "EXPIRED_ACCESS_TOKEN",
+		RefreshToken: "REFRESH_TOKEN",
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+	newTestConfig := func(t *testing.T, testServerURL string, openBrowserCh chan string) oauth2cli.Config {
+		return oauth2cli.Config{
+			OAuth2Config: oauth2.Config{
+				ClientID:     "YOUR_CLIENT_ID",
+				ClientSecret: "YOUR_CLIENT_SECRET",
+				Scopes:       []string{"email", "profile"},
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  testServerURL + "/auth",
+					TokenURL: testServerURL + "/token",
+					// Avoid a retry of the auto detection on an error response.
+					AuthStyle: oauth2.AuthStyleInHeader,
+				},
+			},
+			LocalServerReadyChan:  openBrowserCh,
+			LocalServerMiddleware: loggingMiddleware(t),
+			Logf:                  t.Logf,
+		}
+	}
+
+	t.Run("Refresh", func(t *testing.T) {
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				t.Errorf("authorization request wants no call")
+				return fmt.Sprintf("%s?error=access_denied", req.RedirectURI)
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				if want := "REFRESH_TOKEN"; req.Raw.Get("refresh_token") != want {
+					t.Errorf("refresh_token wants %s but %s", want, req.Raw.Get("refresh_token"))
+					return 400, invalidGrantResponse
+				}
+				return 200, `{"access_token":"NEW_ACCESS_TOKEN","token_type":"Bearer","expires_in":3600}`
+			},
+		})
+		defer testServer.Close()
+		cfg := newTestConfig(t, testServer.URL, nil)
+		token, err := oauth2cli.NewTokenSource(context.TODO(), cfg, expiredToken).Token()
+		if err != nil {
+			t.Fatalf("could not get a token: %s", err)
+		}
+		if want := "NEW_ACCESS_TOKEN"; token.AccessToken != want {
+			t.Errorf("AccessToken wants %s but %s", want, token.AccessToken)
+		}
+		if want := "REFRESH_TOKEN"; token.RefreshToken != want {
+			t.Errorf("RefreshToken wants %s but %s", want, token.RefreshToken)
+		}
+	})
+
+	t.Run("RefreshWithoutIDToken", func(t *testing.T) {
+		key, _ := newKeySet(t)
+		newIDToken := func(subject string) string {
+			return signJWT(t, key, map[string]any{"sub": subject, "aud": "YOUR_CLIENT_ID"})
+		}
+		var idTokenSubject atomic.Value
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				t.Errorf("authorization request wants no call")
+				return fmt.Sprintf("%s?error=access_denied", req.RedirectURI)
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				if subject, ok := idTokenSubject.Load().(string); ok {
+					return 200, fmt.Sprintf(`{"access_token":"NEW_ACCESS_TOKEN","token_type":"Bearer","expires_in":3600,"id_token":%q}`, newIDToken(subject))
+				}
+				// The provider omits the ID token and scope in the refresh response.
+				return 200, `{"access_token":"NEW_ACCESS_TOKEN","token_type":"Bearer","expires_in":3600}`
+			},
+			NewUserInfoResponse: func(req authserver.UserInfoRequest) (int, string) {
+				if want := "Bearer NEW_ACCESS_TOKEN"; req.Header.Get("Authorization") != want {
+					t.Errorf("Authorization wants %s but %s", want, req.Header.Get("Authorization"))
+					return 401, `{"error":"invalid_token"}`
+				}
+				return 200, `{"sub":"USER_ID","email":"alice@example.com"}`
+			},
+		})
+		defer testServer.Close()
+		cfg := newTestConfig(t, testServer.URL, nil)
+		cfg.UserInfoURL = testServer.URL + "/userinfo"
+		expiredOIDCToken := expiredToken.WithExtra(map[string]any{
+			"id_token": newIDToken("USER_ID"),
+			"scope":    "openid email",
+		})
+
+		token, err := oauth2cli.NewTokenSource(context.TODO(), cfg, expiredOIDCToken).Token()
+		if err != nil {
+			t.Fatalf("could not get a token: %s", err)
+		}
+		if token.Extra("id_token") != expiredOIDCToken.Extra("id_token") {
+			t.Errorf("id_token wants the previous one but was %v", token.Extra("id_token"))
+		}
+		if want := "openid email"; token.Extra("scope") != want {
+			t.Errorf("scope wants %s but %v", want, token.Extra("scope"))
+		}
+		userInfo, err := oauth2cli.GetUserInfo(context.TODO(), cfg, token)
+		if err != nil {
+			t.Fatalf("GetUserInfo error: %s", err)
+		}
+		if want := "USER_ID"; userInfo.Subject != want {
+			t.Errorf("Subject wants %s but %s", want, userInfo.Subject)
+		}
+
+		// The provider returns an ID token of another user.
+		idTokenSubject.Store("ANOTHER_USER_ID")
+		_, err = oauth2cli.NewTokenSource(context.TODO(), cfg, expiredOIDCToken).Token()
+		var verificationErr *oauth2cli.IDTokenVerificationError
+		if !errors.As(err, &verificationErr) || verificationErr.Claim != "sub" {
+			t.Errorf("err wants IDTokenVerificationError of sub but was %v", err)
+		}
+	})
+
+	t.Run("RefreshServerError", func(t *testing.T) {
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				t.Errorf("authorization request wants no call")
+				return fmt.Sprintf("%s?error=access_denied", req.RedirectURI)
+			},
+			NewTokenResponse: func(authserver.TokenRequest) (int, string) {
+				return 503, `{"error":"temporarily_unavailable"}`
+			},
+		})
+		defer testServer.Close()
+		cfg := newTestConfig(t, testServer.URL, nil)
+		if _, err := oauth2cli.NewTokenSource(context.TODO(), cfg, expiredToken).Token(); err == nil {
+			t.Errorf("err wants non-nil but was nil")
+		}
+	})
+
+	t.Run("FallbackOnInvalidGrant", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+		defer cancel()
+		var authorizationRequests, refreshRequests atomic.Int32
+		testServer := httptest.NewServer(&authserver.Handler{
+			TestingT: t,
+			NewAuthorizationResponse: func(req authserver.AuthorizationRequest) string {
+				authorizationRequests.Add(1)
+				return fmt.Sprintf("%s?state=%s&code=%s", req.RedirectURI, req.State, "AUTH_CODE")
+			},
+			NewTokenResponse: func(req authserver.TokenRequest) (int, string) {
+				if req.GrantType == "refresh_token" {
+					refreshRequests.Add(1)
+					return 400, invalidGrantResponse
+				}
+				if want := "AUTH_CODE"; req.Code != want {
+					t.Errorf("code wants %s but %s", want, req.Code)
+					return 400, invalidGrantResponse
+				}
+				return 200, validTokenResponse
+			},
+		})
+		defer testServer.Close()
+		openBrowserCh := make(chan string)
+		tokenSource := oauth2cli.NewTokenSource(ctx, newTestConfig(t, testServer.URL, openBrowserCh), expiredToken)
+
+		var wg, callers sync.WaitGroup
+		for range 3 {
+			callers.Add(1)
+			go func() {
+				defer callers.Done()
+				token, err := tokenSource.Token()
+				if err != nil {
+					t.Errorf("could not get a token: %s", err)
+					return
+				}
+				if want := "ACCESS_TOKEN"; token.AccessToken != want {
+					t.Errorf("AccessToken wants %s but %s", want, token.AccessToken)
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			toURL, ok := <-openBrowserCh
+			if !ok {
+				t.Errorf("server already closed")
+				return
+			}
+			client.GetAndVerify(t, toURL, 200, oauth2cli.DefaultLocalServerSuccessHTML)
+		}()
+		callers.Wait()
+		close(openBrowserCh)
+		wg.Wait()
+		if n := authorizationRequests.Load(); n != 1 {
+			t.Errorf("authorization requests wants 1 but %d", n)
+		}
+		if n := refreshRequests.Load(); n != 1 {
+			t.Errorf("refresh requests wants 1 but %d", n)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package e2e_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/int128/oauth2cli"
+	"github.com/int128/oauth2cli/e2e_test/authserver"
+	"golang.org/x/oauth2"
+)
+
+func TestGetUserInfo(t *testing.T) {
+	key, jwks := newKeySet(t)
+	token := (&oauth2.Token{AccessToken: "ACCESS_TOKEN", TokenType: "Bearer"}).WithExtra(map[string]any{
+		"id_token": signJWT(t, key, map[string]any{"sub": "USER_ID"}),
+	})
+	for name, c := range map[string]struct {
+		newResponse func(issuer string) string
+		wantErr     error
+	}{
+		"JSON": {
+			newResponse: func(string) string {
+				return `{"sub":"USER_ID","email":"alice@example.com"}`
+			},
+		},
+		"JWT": {
+			newResponse: func(issuer string) string {
+				return signJWT(t, key, map[string]any{
+					"iss":   issuer,
+					"aud":   "YOUR_CLIENT_ID",
+					"sub":   "USER_ID",
+					"email": "alice@example.com",
+				})
+			},
+		},
+		"SubjectMismatch": {
+			newResponse: func(string) string {
+				return `{"sub":"ANOTHER_USER_ID","email":"alice@example.com"}`
+			},
+			wantErr: oauth2cli.ErrSubjectMismatch,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var testServer *httptest.Server
+			testServer = httptest.NewServer(&authserver.Handler{
+				TestingT: t,
+				JWKS:     jwks,
+				NewUserInfoResponse: func(req authserver.UserInfoRequest) (int, string) {
+					if want := "Bearer ACCESS_TOKEN"; req.Header.Get("Authorization") != want {
+						t.Errorf("Authorization wants %s but %s", want, req.Header.Get("Authorization"))
+						return 401, `{"error":"invalid_token"}`
+					}
+					return 200, c.newResponse(testServer.URL)
+				},
+			})
+			defer testServer.Close()
+			cfg := oauth2cli.Config{
+				OAuth2Config: oauth2.Config{ClientID: "YOUR_CLIENT_ID"},
+				Issuer:       testServer.URL,
+				JWKSURL:      testServer.URL + "/jwks",
+				UserInfoURL:  testServer.URL + "/userinfo",
+				Logf:         t.Logf,
+			}
+			userInfo, err := oauth2cli.GetUserInfo(context.TODO(), cfg, token)
+			if c.wantErr != nil {
+				if !errors.Is(err, c.wantErr) {
+					t.Errorf("err wants %s but was %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not get the user info: %s", err)
+			}
+			if want := "alice@example.com"; userInfo.DisplayName() != want {
+				t.Errorf("DisplayName wants %s but %s", want, userInfo.DisplayName())
+			}
+		})
+	}
+}
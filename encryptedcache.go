@@ -0,0 +1,329 @@
+package oauth2cli
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+)
+
+// ErrTokenCacheTampered is returned when the encrypted token cannot be authenticated,
+// i.e., the cache has been modified or replaced with a plain token.
+var ErrTokenCacheTampered = errors.New("token cache has been tampered with")
+
+// ErrEncryptionKeyNotFound is returned when the token is encrypted by a key
+// which is provided by neither KeyProvider nor PreviousKeyProviders.
+var ErrEncryptionKeyNotFound = errors.New("encryption key not found")
+
+const (
+	// encryptedTokenType is the token type of an encrypted token stored in the underlying cache.
+	encryptedTokenType = "oauth2cli-encrypted"
+
+	// encryptedTokenVersion is the version of the format of an encrypted token.
+	encryptedTokenVersion = 1
+
+	// kdfScrypt is the key derivation function of a passphrase.
+	// See https://www.rfc-editor.org/rfc/rfc7914
+	kdfScrypt = "scrypt"
+
+	// Parameters of scrypt, which costs about 32 MiB of memory.
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+
+	// kdfHKDF is the key derivation function of a random secret.
+	// See https://www.rfc-editor.org/rfc/rfc5869
+	kdfHKDF = "hkdf-sha256"
+
+	// hkdfInfo is the context of the key derived by HKDF.
+	hkdfInfo = "oauth2cli token cache"
+)
+
+// EncryptionKey represents a secret to encrypt the token cache.
+type EncryptionKey struct {
+	// Identifier of the key, which is stored with the encrypted token to select the key on decryption.
+	// This must be unique among the current and previous keys.
+	ID string
+
+	// Secret such as a passphrase or random bytes.
+	Secret []byte
+
+	// If true, Secret is a passphrase chosen by the user.
+	// The encryption key is derived from the passphrase with a random salt by scrypt,
+	// which is memory-hard against a brute force attack but takes about 100ms on each Load and Save.
+	// Otherwise, Secret must be random bytes with enough entropy, such as 32 bytes,
+	// and the encryption key is derived by HKDF-SHA256.
+	Passphrase bool
+}
+
+// KeyProvider is an interface to provide the key to encrypt the token cache.
+type KeyProvider interface {
+	EncryptionKey() (*EncryptionKey, error)
+}
+
+// KeyProviderFunc is an adapter to use a function as KeyProvider.
+type KeyProviderFunc func() (*EncryptionKey, error)
+
+// EncryptionKey calls f().
+func (f KeyProviderFunc) EncryptionKey() (*EncryptionKey, error) {
+	return f()
+}
+
+// PassphraseKeyProvider returns a KeyProvider of the passphrase.
+// The encryption key is derived by scrypt.
+func PassphraseKeyProvider(id, passphrase string) KeyProvider {
+	return KeyProviderFunc(func() (*EncryptionKey, error) {
+		if passphrase == "" {
+			return nil, errors.New("passphrase is empty")
+		}
+		return &EncryptionKey{ID: id, Secret: []byte(passphrase), Passphrase: true}, nil
+	})
+}
+
+// EnvKeyProvider returns a KeyProvider which reads the secret from the environment variable.
+// The secret must be random, e.g., generated by openssl rand -base64 32.
+// The ID of the key is the name of the variable and the fingerprint of the secret,
+// so that a token encrypted by the previous secret of the same variable is reported as ErrEncryptionKeyNotFound.
+func EnvKeyProvider(name string) KeyProvider {
+	return KeyProviderFunc(func() (*EncryptionKey, error) {
+		secret := os.Getenv(name)
+		if secret == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return &EncryptionKey{ID: name + ":" + secretFingerprint([]byte(secret)), Secret: []byte(secret)}, nil
+	})
+}
+
+// secretFingerprint returns the truncated SHA-256 hash of the secret.
+// This must be used only for a random secret, because a passphrase can be guessed from it.
+func secretFingerprint(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:8])
+}
+
+// CommandKeyProvider returns a KeyProvider which reads the secret from the standard output of the command,
+// such as a password manager or OS keychain.
+// The secret must be random, e.g., generated by openssl rand -base64 32.
+// The trailing newline of the output is removed.
+func CommandKeyProvider(id string, name string, arg ...string) KeyProvider {
+	return KeyProviderFunc(func() (*EncryptionKey, error) {
+		out, err := exec.Command(name, arg...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("could not run the key command %s: %w", name, err)
+		}
+		secret := strings.TrimRight(string(out), "\r\n")
+		if secret == "" {
+			return nil, fmt.Errorf("key command %s returned an empty output", name)
+		}
+		return &EncryptionKey{ID: id, Secret: []byte(secret)}, nil
+	})
+}
+
+// EncryptedTokenCache is a TokenCache which encrypts the tokens with AES-256-GCM.
+// The encrypted token is stored in the underlying Cache as an opaque token.
+// The ciphertext is bound to the TokenCacheKey, so that an entry cannot be moved to another key.
+// The encryption key is derived by scrypt or HKDF, see EncryptionKey.Passphrase.
+//
+// To rotate the key, set the new key to KeyProvider and the old one to PreviousKeyProviders.
+// A token encrypted by a previous key is re-encrypted by the current key when it is loaded.
+type EncryptedTokenCache struct {
+	// Cache to store the encrypted tokens, such as FileTokenCache.
+	Cache TokenCache
+
+	// Provider of the key to encrypt and decrypt the tokens.
+	KeyProvider KeyProvider
+
+	// Providers of the previous keys, which are used only to decrypt the tokens.
+	// Default to none.
+	PreviousKeyProviders []KeyProvider
+}
+
+// encryptedToken represents the format of an encrypted token.
+type encryptedToken struct {
+	Version    int    `json:"v"`
+	KeyID      string `json:"kid"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Load returns the token of the key.
+// If the token has been modified, it returns an error wrapping ErrTokenCacheTampered.
+func (c *EncryptedTokenCache) Load(key TokenCacheKey) (*oauth2.Token, error) {
+	stored, err := c.Cache.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, nil
+	}
+	if stored.TokenType != encryptedTokenType {
+		return nil, fmt.Errorf("%w: the token is not encrypted", ErrTokenCacheTampered)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(stored.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenCacheTampered, err)
+	}
+	var e encryptedToken
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenCacheTampered, err)
+	}
+	if e.Version != encryptedTokenVersion {
+		return nil, fmt.Errorf("unsupported version %d of the encrypted token", e.Version)
+	}
+	encryptionKey, current, err := c.findKey(e.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := e.open(encryptionKey, key)
+	if err != nil {
+		return nil, err
+	}
+	var t cachedToken
+	if err := json.Unmarshal(plaintext, &t); err != nil {
+		return nil, fmt.Errorf("invalid token cache: %w", err)
+	}
+	token := t.token()
+	if !current {
+		// Re-encrypt by the current key. The token can be used even if this fails.
+		_ = c.Save(key, token)
+	}
+	return token, nil
+}
+
+// Save encrypts the token by the current key and stores it.
+func (c *EncryptedTokenCache) Save(key TokenCacheKey, token *oauth2.Token) error {
+	encryptionKey, err := c.KeyProvider.EncryptionKey()
+	if err != nil {
+		return fmt.Errorf("could not get the encryption key: %w", err)
+	}
+	plaintext, err := json.Marshal(newCachedToken(token))
+	if err != nil {
+		return fmt.Errorf("could not encode the token: %w", err)
+	}
+	e, err := sealToken(encryptionKey, key, plaintext)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not encode the encrypted token: %w", err)
+	}
+	return c.Cache.Save(key, &oauth2.Token{
+		AccessToken: base64.RawURLEncoding.EncodeToString(b),
+		TokenType:   encryptedTokenType,
+	})
+}
+
+// Delete removes the token of the key.
+func (c *EncryptedTokenCache) Delete(key TokenCacheKey) error {
+	return c.Cache.Delete(key)
+}
+
+// findKey returns the key of the ID, and whether it is the current key.
+func (c *EncryptedTokenCache) findKey(id string) (*EncryptionKey, bool, error) {
+	for i, provider := range append([]KeyProvider{c.KeyProvider}, c.PreviousKeyProviders...) {
+		encryptionKey, err := provider.EncryptionKey()
+		if err != nil {
+			return nil, false, fmt.Errorf("could not get the encryption key: %w", err)
+		}
+		if encryptionKey.ID == id {
+			return encryptionKey, i == 0, nil
+		}
+	}
+	return nil, false, fmt.Errorf("%w: %s", ErrEncryptionKeyNotFound, id)
+}
+
+func sealToken(encryptionKey *EncryptionKey, key TokenCacheKey, plaintext []byte) (*encryptedToken, error) {
+	e := &encryptedToken{
+		Version: encryptedTokenVersion,
+		KeyID:   encryptionKey.ID,
+		KDF:     kdfOf(encryptionKey),
+		Salt:    make([]byte, 16),
+	}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return nil, fmt.Errorf("could not generate a salt: %w", err)
+	}
+	aead, err := e.newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, fmt.Errorf("could not generate a nonce: %w", err)
+	}
+	additionalData, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode the token cache key: %w", err)
+	}
+	e.Ciphertext = aead.Seal(nil, e.Nonce, plaintext, additionalData)
+	return e, nil
+}
+
+func (e *encryptedToken) open(encryptionKey *EncryptionKey, key TokenCacheKey) ([]byte, error) {
+	aead, err := e.newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid nonce", ErrTokenCacheTampered)
+	}
+	additionalData, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode the token cache key: %w", err)
+	}
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenCacheTampered, err)
+	}
+	return plaintext, nil
+}
+
+// newAEAD derives the key from the secret and returns the AES-256-GCM cipher.
+func (e *encryptedToken) newAEAD(encryptionKey *EncryptionKey) (cipher.AEAD, error) {
+	// The parameters are fixed, so that a modified cache cannot weaken the derivation or consume the resources.
+	if e.KDF != kdfOf(encryptionKey) {
+		return nil, fmt.Errorf("%w: kdf %s does not match the key", ErrTokenCacheTampered, e.KDF)
+	}
+	var derived []byte
+	var err error
+	switch e.KDF {
+	case kdfScrypt:
+		derived, err = scrypt.Key(encryptionKey.Secret, e.Salt, scryptN, scryptR, scryptP, 32)
+	case kdfHKDF:
+		derived, err = hkdf.Key(sha256.New, encryptionKey.Secret, e.Salt, hkdfInfo, 32)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not derive the key: %w", err)
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// kdfOf returns the key derivation function of the key.
+func kdfOf(encryptionKey *EncryptionKey) string {
+	if encryptionKey.Passphrase {
+		return kdfScrypt
+	}
+	return kdfHKDF
+}
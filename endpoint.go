@@ -0,0 +1,155 @@
+package oauth2cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// contextClient returns the HTTP client in the context, like golang.org/x/oauth2 does.
+// You can set a custom client by oauth2.HTTPClient key.
+func contextClient(ctx context.Context) *http.Client {
+	if hc, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		return hc
+	}
+	return http.DefaultClient
+}
+
+// postForm sends the form parameters to the endpoint of the authorization server.
+// This authenticates the client in the same way as the token request, i.e.,
+// the client secret is sent in the params if Endpoint.AuthStyle is oauth2.AuthStyleInParams,
+// otherwise it is sent in the Authorization header.
+// It returns an *oauth2.RetrieveError if the server responds an error.
+func postForm(ctx context.Context, oauth2Config *oauth2.Config, endpointURL string, params url.Values) (*http.Response, []byte, error) {
+	return postFormWithHeader(ctx, oauth2Config, endpointURL, params, nil)
+}
+
+// postFormWithHeader sends the form parameters with the additional header, such as Accept.
+func postFormWithHeader(ctx context.Context, oauth2Config *oauth2.Config, endpointURL string, params url.Values, header http.Header) (*http.Response, []byte, error) {
+	params = cloneValues(params)
+	useBasicAuth := oauth2Config.ClientSecret != "" && oauth2Config.Endpoint.AuthStyle != oauth2.AuthStyleInParams
+	if !useBasicAuth {
+		params.Set("client_id", oauth2Config.ClientID)
+		if oauth2Config.ClientSecret != "" {
+			params.Set("client_secret", oauth2Config.ClientSecret)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create a request: %w", err)
+	}
+	for k, vv := range header {
+		req.Header[k] = vv
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if useBasicAuth {
+		req.SetBasicAuth(url.QueryEscape(oauth2Config.ClientID), url.QueryEscape(oauth2Config.ClientSecret))
+	}
+	return doRequest(req)
+}
+
+// doRequest sends the request and returns the response body.
+// It returns an *oauth2.RetrieveError if the status code is not 2xx.
+func doRequest(req *http.Request) (*http.Response, []byte, error) {
+	resp, err := contextClient(req.Context()).Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not send a request: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp, nil, fmt.Errorf("could not read the response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, body, newRetrieveError(resp, body)
+	}
+	return resp, body, nil
+}
+
+// newRetrieveError parses the error response described in
+// https://www.rfc-editor.org/rfc/rfc6749#section-5.2
+func newRetrieveError(resp *http.Response, body []byte) *oauth2.RetrieveError {
+	retrieveErr := &oauth2.RetrieveError{Response: resp, Body: body}
+	if content, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); content != "application/json" {
+		return retrieveErr
+	}
+	var errorResponse struct {
+		ErrorCode        string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+		ErrorURI         string `json:"error_uri"`
+	}
+	if json.Unmarshal(body, &errorResponse) != nil {
+		return retrieveErr
+	}
+	retrieveErr.ErrorCode = errorResponse.ErrorCode
+	retrieveErr.ErrorDescription = errorResponse.ErrorDescription
+	retrieveErr.ErrorURI = errorResponse.ErrorURI
+	return retrieveErr
+}
+
+// appendQuery returns the URL with the query parameters.
+func appendQuery(baseURL string, params url.Values) string {
+	if strings.Contains(baseURL, "?") {
+		return baseURL + "&" + params.Encode()
+	}
+	return baseURL + "?" + params.Encode()
+}
+
+func cloneValues(v url.Values) url.Values {
+	c := make(url.Values, len(v))
+	for k, vv := range v {
+		c[k] = append([]string(nil), vv...)
+	}
+	return c
+}
+
+// tokenResponse represents a successful response of the token endpoint.
+// See https://www.rfc-editor.org/rfc/rfc6749#section-5.1
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// retrieveToken sends the token request with the client authentication.
+// This is used for a token request which cannot be expressed by oauth2.Config,
+// such as multiple values of a parameter.
+func retrieveToken(ctx context.Context, oauth2Config *oauth2.Config, params url.Values) (*oauth2.Token, error) {
+	_, body, err := postForm(ctx, oauth2Config, oauth2Config.Endpoint.TokenURL, params)
+	if err != nil {
+		return nil, err
+	}
+	var resp tokenResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return nil, errors.New("invalid token response: access_token is missing")
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	token := &oauth2.Token{
+		AccessToken:  resp.AccessToken,
+		TokenType:    resp.TokenType,
+		RefreshToken: resp.RefreshToken,
+		ExpiresIn:    resp.ExpiresIn,
+	}
+	if resp.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return token.WithExtra(raw), nil
+}
@@ -19,6 +19,7 @@ func init() {
 }
 
 type cmdOptions struct {
+	issuer          string
 	authURL         string
 	tokenURL        string
 	clientID        string
@@ -30,6 +31,7 @@ type cmdOptions struct {
 
 func main() {
 	var o cmdOptions
+	flag.StringVar(&o.issuer, "issuer", "", "Issuer URL to discover the endpoints (optional)")
 	flag.StringVar(&o.authURL, "auth-url", "https://accounts.google.com/o/oauth2/auth", "Authorization URL of the endpoint")
 	flag.StringVar(&o.tokenURL, "token-url", "https://oauth2.googleapis.com/token", "Authorization URL of the endpoint")
 	flag.StringVar(&o.clientID, "client-id", "", "OAuth Client ID")
@@ -52,7 +54,6 @@ Then set the following options:`)
 
 	ready := make(chan string, 1)
 	defer close(ready)
-	pkceVerifier := oauth2.GenerateVerifier()
 	cfg := oauth2cli.Config{
 		OAuth2Config: oauth2.Config{
 			ClientID:     o.clientID,
@@ -63,8 +64,7 @@ Then set the following options:`)
 			},
 			Scopes: strings.Split(o.scopes, ","),
 		},
-		AuthCodeOptions:      []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(pkceVerifier)},
-		TokenRequestOptions:  []oauth2.AuthCodeOption{oauth2.VerifierOption(pkceVerifier)},
+		PKCE:                 true,
 		LocalServerReadyChan: ready,
 		LocalServerCertFile:  o.localServerCert,
 		LocalServerKeyFile:   o.localServerKey,
@@ -72,6 +72,14 @@ Then set the following options:`)
 	}
 
 	ctx := context.Background()
+	if o.issuer != "" {
+		cfg.OAuth2Config.Endpoint = oauth2.Endpoint{}
+		var err error
+		cfg, err = oauth2cli.NewConfigFromIssuer(ctx, o.issuer, cfg)
+		if err != nil {
+			log.Fatalf("could not discover the provider: %s", err)
+		}
+	}
 	eg, ctx := errgroup.WithContext(ctx)
 	eg.Go(func() error {
 		select {
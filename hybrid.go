@@ -0,0 +1,58 @@
+package oauth2cli
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/int128/oauth2cli/internal/jwt"
+)
+
+// verifyHybridIDToken verifies the ID token in the authorization response of the hybrid flow,
+// and the c_hash claim against the code.
+// See https://openid.net/specs/openid-connect-core-1_0.html#HybridIDToken
+func verifyHybridIDToken(ctx context.Context, cfg *Config, rawIDToken, code string) (*IDToken, error) {
+	if rawIDToken == "" {
+		return nil, &IDTokenVerificationError{Err: errors.New("id_token is missing in the authorization response")}
+	}
+	idToken, err := verifyRawIDToken(ctx, cfg, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	var claims struct {
+		CodeHash string `json:"c_hash"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, &IDTokenVerificationError{Err: err}
+	}
+	if claims.CodeHash == "" {
+		return nil, &IDTokenVerificationError{Claim: "c_hash", Err: errors.New("c_hash is missing")}
+	}
+	want, err := jwt.LeftHalfHash(idToken.algorithm, code)
+	if err != nil {
+		return nil, &IDTokenVerificationError{Claim: "c_hash", Err: err}
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.CodeHash), []byte(want)) != 1 {
+		return nil, &IDTokenVerificationError{Claim: "c_hash", Err: errors.New("c_hash does not match the code")}
+	}
+	return idToken, nil
+}
+
+// verifySameSubject verifies the ID token of the token response has the same iss and sub
+// as the ID token of the authorization response.
+// See https://openid.net/specs/openid-connect-core-1_0.html#HybridTokenResponse
+func verifySameSubject(authorizationIDToken, tokenIDToken *IDToken) error {
+	if tokenIDToken == nil {
+		return nil
+	}
+	if tokenIDToken.Issuer != authorizationIDToken.Issuer {
+		return &IDTokenVerificationError{Claim: "iss",
+			Err: fmt.Errorf("iss does not match the authorization response (wants %s but got %s)", authorizationIDToken.Issuer, tokenIDToken.Issuer)}
+	}
+	if tokenIDToken.Subject != authorizationIDToken.Subject {
+		return &IDTokenVerificationError{Claim: "sub",
+			Err: fmt.Errorf("sub does not match the authorization response (wants %s but got %s)", authorizationIDToken.Subject, tokenIDToken.Subject)}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK represents a JSON Web Key of a public key.
+// See https://www.rfc-editor.org/rfc/rfc7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKS represents a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK returns a JWK of the public key.
+func NewJWK(pub crypto.PublicKey) (*JWK, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			KeyType: "RSA",
+			N:       encodeSegment(pub.N.Bytes()),
+			E:       encodeSegment(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		ecdh, err := pub.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("invalid ECDSA key: %w", err)
+		}
+		// uncompressed point: 0x04 || X || Y
+		b := ecdh.Bytes()
+		return &JWK{
+			KeyType: "EC",
+			Curve:   pub.Curve.Params().Name,
+			X:       encodeSegment(b[1 : 1+size]),
+			Y:       encodeSegment(b[1+size:]),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       encodeSegment(pub),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", pub)
+}
+
+// PublicKey returns the public key of the JWK.
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Curve)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := decodeSegment(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC key length")
+		}
+		pub, err := ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		return pub, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Curve)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key length")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.KeyType)
+}
+
+// Verify verifies the token by the keys in the set.
+// If the token has the kid header, only the key of the same kid is used.
+// It returns ErrKeyNotFound if no key is available for the token.
+func (s *JWKS) Verify(token *Token) error {
+	var found bool
+	var lastErr error
+	for i := range s.Keys {
+		k := &s.Keys[i]
+		if token.Header.KeyID != "" && k.KeyID != token.Header.KeyID {
+			continue
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Algorithm != "" && k.Algorithm != token.Header.Algorithm {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		found = true
+		if lastErr = token.Verify(pub); lastErr == nil {
+			return nil
+		}
+	}
+	if !found {
+		return ErrKeyNotFound
+	}
+	return lastErr
+}
+
+// ErrKeyNotFound is returned if no key is available for the token.
+var ErrKeyNotFound = errors.New("no key found for the token")
+
+// Thumbprint returns the JWK SHA-256 thumbprint encoded in base64url.
+// See https://www.rfc-editor.org/rfc/rfc7638
+func (k *JWK) Thumbprint() (string, error) {
+	// The required members in the lexicographic order.
+	var members string
+	switch k.KeyType {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, k.E, k.KeyType, k.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Curve, k.KeyType, k.X, k.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, k.Curve, k.KeyType, k.X)
+	default:
+		return "", fmt.Errorf("unsupported key type %s", k.KeyType)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return encodeSegment(sum[:]), nil
+}
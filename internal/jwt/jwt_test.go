@@ -0,0 +1,122 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	for alg, signer := range map[string]crypto.Signer{
+		"RS256": rsaKey,
+		"ES384": ecKey,
+		"EdDSA": edKey,
+	} {
+		t.Run(alg, func(t *testing.T) {
+			s, err := Sign(signer, Header{KeyID: "KEY_ID"}, map[string]string{"sub": "SUBJECT"})
+			if err != nil {
+				t.Fatalf("Sign: %s", err)
+			}
+			token, err := Parse(s)
+			if err != nil {
+				t.Fatalf("Parse: %s", err)
+			}
+			if token.Header.Algorithm != alg {
+				t.Errorf("alg wants %s but %s", alg, token.Header.Algorithm)
+			}
+			jwk, err := NewJWK(signer.Public())
+			if err != nil {
+				t.Fatalf("NewJWK: %s", err)
+			}
+			jwk.KeyID = "KEY_ID"
+			keySet := JWKS{Keys: []JWK{*jwk}}
+			if err := keySet.Verify(token); err != nil {
+				t.Errorf("Verify: %s", err)
+			}
+			var claims struct {
+				Subject string `json:"sub"`
+			}
+			if err := token.Claims(&claims); err != nil {
+				t.Fatalf("Claims: %s", err)
+			}
+			if claims.Subject != "SUBJECT" {
+				t.Errorf("sub wants SUBJECT but %s", claims.Subject)
+			}
+
+			jwk.KeyID = "ANOTHER_KEY_ID"
+			keySet = JWKS{Keys: []JWK{*jwk}}
+			if err := keySet.Verify(token); err != ErrKeyNotFound {
+				t.Errorf("Verify wants ErrKeyNotFound but %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	s, err := Sign(key, Header{}, map[string]string{"sub": "SUBJECT"})
+	if err != nil {
+		t.Fatalf("Sign: %s", err)
+	}
+	tampered, err := Sign(key, Header{}, map[string]string{"sub": "ATTACKER"})
+	if err != nil {
+		t.Fatalf("Sign: %s", err)
+	}
+	token, err := Parse(tampered[:len(tampered)-86] + s[len(s)-86:])
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	if err := token.Verify(&key.PublicKey); err == nil {
+		t.Errorf("Verify wants error but was nil")
+	}
+	token.Header.Algorithm = "none"
+	if err := token.Verify(&key.PublicKey); err == nil {
+		t.Errorf("Verify wants error for alg none but was nil")
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// https://www.rfc-editor.org/rfc/rfc7638#section-3.1
+	jwk := JWK{
+		KeyType: "RSA",
+		N:       "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:       "AQAB",
+	}
+	got, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("Thumbprint: %s", err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("Thumbprint wants %s but %s", want, got)
+	}
+}
+
+func TestLeftHalfHash(t *testing.T) {
+	// Example in https://openid.net/specs/openid-connect-core-1_0.html#code-id_tokenExample
+	got, err := LeftHalfHash("RS256", "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk")
+	if err != nil {
+		t.Fatalf("LeftHalfHash: %s", err)
+	}
+	if want := "LDktKdoQak3Pk0cnXxCltA"; got != want {
+		t.Errorf("LeftHalfHash wants %s but was %s", want, got)
+	}
+}
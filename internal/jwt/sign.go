@@ -0,0 +1,154 @@
+// Package jwt provides a minimal implementation of JSON Web Signature (JWS) in the compact serialization.
+// See https://www.rfc-editor.org/rfc/rfc7515 and https://www.rfc-editor.org/rfc/rfc7519
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Header represents a JOSE header.
+type Header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	JWK       *JWK   `json:"jwk,omitempty"`
+}
+
+// Sign returns a JWS of the claims in the compact serialization.
+// If header.Algorithm is empty, it is determined by the key type of the signer.
+func Sign(signer crypto.Signer, header Header, claims any) (string, error) {
+	if header.Algorithm == "" {
+		alg, err := Algorithm(signer.Public())
+		if err != nil {
+			return "", err
+		}
+		header.Algorithm = alg
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("could not encode the header: %w", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("could not encode the claims: %w", err)
+	}
+	signingInput := encodeSegment(headerJSON) + "." + encodeSegment(claimsJSON)
+	signature, err := signMessage(signer, header.Algorithm, []byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("could not sign the token: %w", err)
+	}
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// Algorithm returns the default algorithm for the key type.
+func Algorithm(pub crypto.PublicKey) (string, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return "RS256", nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+		return "", fmt.Errorf("unsupported curve %s", pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", pub)
+}
+
+func signMessage(signer crypto.Signer, alg string, message []byte) ([]byte, error) {
+	if alg == "EdDSA" {
+		return signer.Sign(rand.Reader, message, crypto.Hash(0))
+	}
+	hash, err := hashFunc(alg)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(message)
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "RS":
+		return signer.Sign(rand.Reader, digest, hash)
+	case "PS":
+		return signer.Sign(rand.Reader, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash})
+	case "ES":
+		pub, ok := signer.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("algorithm %s requires an ECDSA key", alg)
+		}
+		der, err := signer.Sign(rand.Reader, digest, hash)
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the concatenation of R and S instead of ASN.1 DER.
+		// See https://www.rfc-editor.org/rfc/rfc7518#section-3.4
+		var sig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &sig); err != nil {
+			return nil, fmt.Errorf("invalid ECDSA signature: %w", err)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		b := make([]byte, 2*size)
+		sig.R.FillBytes(b[:size])
+		sig.S.FillBytes(b[size:])
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+func hashFunc(alg string) (crypto.Hash, error) {
+	if len(alg) != 5 {
+		return 0, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, nil
+	case "384":
+		return crypto.SHA384, nil
+	case "512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// LeftHalfHash returns the base64url encoded left-most half of the hash of the value,
+// by the hash function of the algorithm.
+// This is used for c_hash and at_hash claims of OpenID Connect.
+// For EdDSA, SHA-512 is used as the hash of Ed25519.
+// See https://openid.net/specs/openid-connect-core-1_0.html#HybridIDToken
+func LeftHalfHash(alg, value string) (string, error) {
+	hash := crypto.SHA512
+	if alg != "EdDSA" {
+		var err error
+		if hash, err = hashFunc(alg); err != nil {
+			return "", err
+		}
+	}
+	h := hash.New()
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+	return encodeSegment(sum[:len(sum)/2]), nil
+}
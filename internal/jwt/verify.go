@@ -0,0 +1,148 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Token represents a JWS in the compact serialization.
+type Token struct {
+	Header  Header
+	Payload []byte
+
+	signingInput string
+	signature    []byte
+}
+
+// Parse decodes the JWS without verification.
+func Parse(s string) (*Token, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token must have 3 parts but has %d", len(parts))
+	}
+	headerJSON, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the header: %w", err)
+	}
+	var header Header
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("could not decode the header: %w", err)
+	}
+	payload, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the payload: %w", err)
+	}
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the signature: %w", err)
+	}
+	return &Token{
+		Header:       header,
+		Payload:      payload,
+		signingInput: parts[0] + "." + parts[1],
+		signature:    signature,
+	}, nil
+}
+
+// Claims decodes the payload into v.
+func (t *Token) Claims(v any) error {
+	if err := json.Unmarshal(t.Payload, v); err != nil {
+		return fmt.Errorf("could not decode the claims: %w", err)
+	}
+	return nil
+}
+
+// Verify verifies the signature by the public key.
+// The algorithm in the header must be compatible with the key type.
+// It does not accept the none algorithm or MAC algorithms.
+func (t *Token) Verify(pub crypto.PublicKey) error {
+	alg := t.Header.Algorithm
+	if alg == "EdDSA" {
+		pub, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires an Ed25519 key", alg)
+		}
+		if !ed25519.Verify(pub, []byte(t.signingInput), t.signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	hash, err := hashFunc(alg)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write([]byte(t.signingInput))
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "RS":
+		pub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires an RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, t.signature); err != nil {
+			return fmt.Errorf("invalid signature: %w", err)
+		}
+		return nil
+	case "PS":
+		pub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires an RSA key", alg)
+		}
+		if err := rsa.VerifyPSS(pub, hash, digest, t.signature, nil); err != nil {
+			return fmt.Errorf("invalid signature: %w", err)
+		}
+		return nil
+	case "ES":
+		pub, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires an ECDSA key", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// Audience represents the aud claim, which is a string or an array of strings.
+type Audience []string
+
+// UnmarshalJSON accepts both a string and an array of strings.
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings: %w", err)
+	}
+	*a = ss
+	return nil
+}
+
+// Contains returns true if the audience contains the value.
+func (a Audience) Contains(v string) bool {
+	for _, e := range a {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package oauth2cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/int128/oauth2cli/internal/jwt"
+)
+
+// introspectionJWTType is the media type of the JWT introspection response.
+// See https://www.rfc-editor.org/rfc/rfc9701#section-5
+const introspectionJWTType = "token-introspection+jwt"
+
+// IntrospectionResponse represents the response of the token introspection endpoint.
+// If the token is not active, only Active is set.
+// See https://www.rfc-editor.org/rfc/rfc7662#section-2.2
+type IntrospectionResponse struct {
+	Active    bool
+	Scope     string
+	ClientID  string
+	Username  string
+	TokenType string
+	Subject   string
+	Audience  []string
+	Issuer    string
+	JWTID     string
+	Expiry    time.Time // zero if exp is not given
+	IssuedAt  time.Time // zero if iat is not given
+	NotBefore time.Time // zero if nbf is not given
+
+	payload []byte
+}
+
+// Claims decodes the introspection response into v.
+// This is useful to get the extension fields which are not contained in IntrospectionResponse.
+func (r *IntrospectionResponse) Claims(v any) error {
+	if err := json.Unmarshal(r.payload, v); err != nil {
+		return fmt.Errorf("could not decode the claims: %w", err)
+	}
+	return nil
+}
+
+// Scopes returns the space-separated values of the scope.
+func (r *IntrospectionResponse) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+type introspectionClaims struct {
+	Active    bool         `json:"active"`
+	Scope     string       `json:"scope"`
+	ClientID  string       `json:"client_id"`
+	Username  string       `json:"username"`
+	TokenType string       `json:"token_type"`
+	Subject   string       `json:"sub"`
+	Audience  jwt.Audience `json:"aud"`
+	Issuer    string       `json:"iss"`
+	JWTID     string       `json:"jti"`
+	Expiry    int64        `json:"exp"`
+	IssuedAt  int64        `json:"iat"`
+	NotBefore int64        `json:"nbf"`
+}
+
+// introspectionJWTClaims represents the claims of the JWT introspection response.
+// See https://www.rfc-editor.org/rfc/rfc9701#section-5
+type introspectionJWTClaims struct {
+	Issuer             string          `json:"iss"`
+	Audience           jwt.Audience    `json:"aud"`
+	IssuedAt           int64           `json:"iat"`
+	TokenIntrospection json.RawMessage `json:"token_introspection"`
+}
+
+// IntrospectToken queries the state of the token to IntrospectionURL.
+// The client is authenticated in the same way as the token request.
+// tokenTypeHint is optional, such as access_token or refresh_token.
+// See https://www.rfc-editor.org/rfc/rfc7662
+//
+// If IntrospectionJWTResponse is set, it requests a JWT response and verifies it by the key set of JWKSURL.
+// The iss claim must be Issuer and the aud claim must contain the client ID.
+// See https://www.rfc-editor.org/rfc/rfc9701
+//
+// If the server responds an error, it returns an error wrapping *oauth2.RetrieveError.
+func IntrospectToken(ctx context.Context, cfg Config, token, tokenTypeHint string) (*IntrospectionResponse, error) {
+	if err := cfg.validateAndSetDefaults(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.IntrospectionURL == "" {
+		return nil, errors.New("invalid config: IntrospectionURL must be set")
+	}
+	if cfg.IntrospectionJWTResponse && (cfg.Issuer == "" || cfg.JWKSURL == "") {
+		return nil, errors.New("invalid config: both Issuer and JWKSURL must be set for IntrospectionJWTResponse")
+	}
+	params := url.Values{"token": {token}}
+	if tokenTypeHint != "" {
+		params.Set("token_type_hint", tokenTypeHint)
+	}
+	var header http.Header
+	if cfg.IntrospectionJWTResponse {
+		header = http.Header{"Accept": {"application/" + introspectionJWTType}}
+	} else {
+		header = http.Header{"Accept": {"application/json"}}
+	}
+	resp, body, err := postFormWithHeader(ctx, &cfg.OAuth2Config, cfg.IntrospectionURL, params, header)
+	if err != nil {
+		return nil, fmt.Errorf("introspection error: %w", err)
+	}
+	payload := body
+	content, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if cfg.IntrospectionJWTResponse {
+		if content != "application/"+introspectionJWTType {
+			return nil, fmt.Errorf("introspection response must be %s but was %s", introspectionJWTType, content)
+		}
+		payload, err = verifyIntrospectionJWT(ctx, &cfg, string(body))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var claims introspectionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid introspection response: %w", err)
+	}
+	return &IntrospectionResponse{
+		Active:    claims.Active,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Username,
+		TokenType: claims.TokenType,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		JWTID:     claims.JWTID,
+		Expiry:    unixTimeOf(claims.Expiry),
+		IssuedAt:  unixTimeOf(claims.IssuedAt),
+		NotBefore: unixTimeOf(claims.NotBefore),
+		payload:   payload,
+	}, nil
+}
+
+// verifyIntrospectionJWT verifies the JWT introspection response and returns the token_introspection claim.
+// See https://www.rfc-editor.org/rfc/rfc9701#section-5
+func verifyIntrospectionJWT(ctx context.Context, cfg *Config, s string) ([]byte, error) {
+	token, err := verifyJWT(ctx, cfg, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid introspection JWT: %w", err)
+	}
+	if token.Header.Type != introspectionJWTType && token.Header.Type != "application/"+introspectionJWTType {
+		return nil, fmt.Errorf("typ of the introspection JWT must be %s but was %s", introspectionJWTType, token.Header.Type)
+	}
+	var claims introspectionJWTClaims
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid introspection JWT: %w", err)
+	}
+	if claims.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("iss of the introspection JWT does not match (wants %s but got %s)", cfg.Issuer, claims.Issuer)
+	}
+	if !claims.Audience.Contains(cfg.OAuth2Config.ClientID) {
+		return nil, fmt.Errorf("aud of the introspection JWT does not contain the client ID %s", cfg.OAuth2Config.ClientID)
+	}
+	if len(claims.TokenIntrospection) == 0 {
+		return nil, errors.New("invalid introspection JWT: token_introspection is missing")
+	}
+	return claims.TokenIntrospection, nil
+}
+
+// unixTimeOf returns the time of the NumericDate, or zero time if it is not given.
+func unixTimeOf(v int64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(v, 0)
+}
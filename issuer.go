@@ -0,0 +1,43 @@
+package oauth2cli
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// ErrIssuerMismatch is returned when the iss parameter of the authorization response
+// does not match Config.Issuer, which may be a mix-up attack.
+// See https://www.rfc-editor.org/rfc/rfc9207
+var ErrIssuerMismatch = errors.New("issuer does not match")
+
+// IssuerParameterPolicy represents how to handle the iss parameter of the authorization response.
+type IssuerParameterPolicy int
+
+const (
+	// IssuerParameterOptional verifies the iss parameter if it is present.
+	IssuerParameterOptional IssuerParameterPolicy = iota
+
+	// IssuerParameterRequired rejects the authorization response without the iss parameter.
+	// Set this if the provider advertises authorization_response_iss_parameter_supported.
+	IssuerParameterRequired
+)
+
+// verifyIssuerParameter checks the iss parameter of the authorization response against Config.Issuer.
+// This does nothing if Config.Issuer is not set.
+func verifyIssuerParameter(cfg *Config, q url.Values) error {
+	if cfg.Issuer == "" {
+		return nil
+	}
+	if !q.Has("iss") {
+		if cfg.IssuerParameterPolicy == IssuerParameterRequired {
+			return fmt.Errorf("%w: iss parameter is missing", ErrIssuerMismatch)
+		}
+		return nil
+	}
+	if iss := q.Get("iss"); subtle.ConstantTimeCompare([]byte(iss), []byte(cfg.Issuer)) != 1 {
+		return fmt.Errorf("%w (wants %s but got %s)", ErrIssuerMismatch, cfg.Issuer, iss)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package oauth2cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/int128/oauth2cli/internal/jwt"
+	"github.com/int128/oauth2cli/oauth2params"
+)
+
+// requestObjectLifetime is the lifetime of a request object.
+const requestObjectLifetime = 5 * time.Minute
+
+// requestObjectNumericClaims are the parameters which are numbers in the claims of the request object.
+var requestObjectNumericClaims = []string{"max_age"}
+
+// requestObjectJSONClaims are the parameters which are JSON values in the claims of the request object,
+// such as authorization_details of RFC 9396 and claims of OpenID Connect.
+var requestObjectJSONClaims = []string{"authorization_details", "claims"}
+
+// newRequestObjectParams returns the parameters which contain the signed request object.
+// The parameters of the authorization request are moved into the claims of the request object,
+// and only client_id and request are left.
+// If the scope contains openid, response_type and scope are also left,
+// because OpenID Connect requires them outside the request object.
+// See https://www.rfc-editor.org/rfc/rfc9101
+// and https://openid.net/specs/openid-connect-core-1_0.html#RequestObject
+func newRequestObjectParams(cfg *Config, params url.Values) (url.Values, error) {
+	claims := make(map[string]any, len(params)+6)
+	for k, v := range params {
+		switch {
+		case len(v) == 1 && slices.Contains(requestObjectNumericClaims, k):
+			n, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s parameter: %w", k, err)
+			}
+			claims[k] = n
+		case len(v) == 1 && slices.Contains(requestObjectJSONClaims, k):
+			if !json.Valid([]byte(v[0])) {
+				return nil, fmt.Errorf("invalid %s parameter: not a JSON value", k)
+			}
+			claims[k] = json.RawMessage(v[0])
+		case len(v) == 1:
+			claims[k] = v[0]
+		default:
+			claims[k] = v
+		}
+	}
+	jti, err := oauth2params.NewState()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate a jti claim: %w", err)
+	}
+	audience, err := cfg.requestObjectAudience()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	claims["iss"] = cfg.OAuth2Config.ClientID
+	claims["aud"] = audience
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(requestObjectLifetime).Unix()
+	claims["jti"] = jti
+	requestObject, err := jwt.Sign(cfg.RequestObjectSigner, jwt.Header{
+		Type:  "oauth-authz-req+jwt",
+		KeyID: cfg.RequestObjectKeyID,
+	}, claims)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign the request object: %w", err)
+	}
+	requestParams := url.Values{
+		"client_id": {cfg.OAuth2Config.ClientID},
+		"request":   {requestObject},
+	}
+	if slices.Contains(strings.Fields(params.Get("scope")), "openid") {
+		requestParams.Set("response_type", params.Get("response_type"))
+		requestParams.Set("scope", params.Get("scope"))
+	}
+	return requestParams, nil
+}
+
+func (cfg *Config) requestObjectAudience() (string, error) {
+	if cfg.RequestObjectAudience != "" {
+		return cfg.RequestObjectAudience, nil
+	}
+	authURL, err := url.Parse(cfg.OAuth2Config.Endpoint.AuthURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid OAuth2Config.Endpoint.AuthURL: %w", err)
+	}
+	return (&url.URL{Scheme: authURL.Scheme, Host: authURL.Host}).String(), nil
+}
@@ -0,0 +1,62 @@
+package oauth2cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/int128/oauth2cli/internal/jwt"
+)
+
+// jarmClaims represents the claims of an authorization response JWT.
+// See https://openid.net/specs/oauth-v2-jarm.html#section-2.1
+type jarmClaims struct {
+	Issuer           string       `json:"iss"`
+	Audience         jwt.Audience `json:"aud"`
+	Expiry           int64        `json:"exp"`
+	Code             string       `json:"code"`
+	State            string       `json:"state"`
+	Error            string       `json:"error"`
+	ErrorDescription string       `json:"error_description"`
+}
+
+// verifyJARMResponse verifies the response parameter of JARM,
+// and returns the parameters of the authorization response in the claims.
+// See https://openid.net/specs/oauth-v2-jarm.html#section-2.4
+func verifyJARMResponse(ctx context.Context, cfg *Config, response string) (url.Values, error) {
+	token, err := verifyJWT(ctx, cfg, response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization response JWT: %w", err)
+	}
+	var claims jarmClaims
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid authorization response JWT: %w", err)
+	}
+	if claims.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("iss of the authorization response JWT does not match (wants %s but got %s)", cfg.Issuer, claims.Issuer)
+	}
+	if !claims.Audience.Contains(cfg.OAuth2Config.ClientID) {
+		return nil, fmt.Errorf("aud of the authorization response JWT does not contain the client ID %s", cfg.OAuth2Config.ClientID)
+	}
+	if claims.Expiry == 0 {
+		return nil, errors.New("exp of the authorization response JWT is missing")
+	}
+	if time.Now().Add(-allowedClockSkew).After(time.Unix(claims.Expiry, 0)) {
+		return nil, fmt.Errorf("the authorization response JWT has expired at %s", time.Unix(claims.Expiry, 0))
+	}
+	q := make(url.Values)
+	for k, v := range map[string]string{
+		"iss":               claims.Issuer,
+		"code":              claims.Code,
+		"state":             claims.State,
+		"error":             claims.Error,
+		"error_description": claims.ErrorDescription,
+	} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	return q, nil
+}
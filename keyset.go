@@ -0,0 +1,108 @@
+package oauth2cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/int128/oauth2cli/internal/jwt"
+)
+
+// allowedClockSkew is the tolerance of the clock difference on verification of a JWT.
+const allowedClockSkew = 1 * time.Minute
+
+// fetchKeySet retrieves the JSON Web Key Set of the authorization server.
+func fetchKeySet(ctx context.Context, jwksURL string) (*jwt.JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	_, body, err := doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the key set from %s: %w", jwksURL, err)
+	}
+	var keySet jwt.JWKS
+	if err := json.Unmarshal(body, &keySet); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+	return &keySet, nil
+}
+
+// keySetRefreshInterval is the minimum interval to fetch the key set again on an unknown key ID,
+// to prevent a JWT with an arbitrary key ID from flooding the authorization server.
+const keySetRefreshInterval = 1 * time.Minute
+
+// keySetCache holds the key sets by the URL, to avoid fetching them on every verification.
+type keySetCache struct {
+	mu        sync.Mutex
+	keySets   map[string]*jwt.JWKS
+	refreshed map[string]time.Time
+}
+
+var keySets keySetCache
+
+func (c *keySetCache) get(jwksURL string) *jwt.JWKS {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keySets[jwksURL]
+}
+
+func (c *keySetCache) put(jwksURL string, keySet *jwt.JWKS) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keySets == nil {
+		c.keySets = make(map[string]*jwt.JWKS)
+	}
+	c.keySets[jwksURL] = keySet
+}
+
+// tryRefresh returns true if the key set can be fetched again,
+// i.e., it has not been refreshed within keySetRefreshInterval.
+func (c *keySetCache) tryRefresh(jwksURL string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.refreshed[jwksURL]) < keySetRefreshInterval {
+		return false
+	}
+	if c.refreshed == nil {
+		c.refreshed = make(map[string]time.Time)
+	}
+	c.refreshed[jwksURL] = time.Now()
+	return true
+}
+
+// verifyJWT verifies the signature of the JWT by the key set of JWKSURL.
+// The key set is cached in memory.
+// If the cached key set does not have the key of the JWT, it fetches the key set again and retries,
+// because the authorization server may have rotated the keys.
+// This is throttled by keySetRefreshInterval.
+func verifyJWT(ctx context.Context, cfg *Config, s string) (*jwt.Token, error) {
+	token, err := jwt.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT: %w", err)
+	}
+	if keySet := keySets.get(cfg.JWKSURL); keySet != nil {
+		err := keySet.Verify(token)
+		if err == nil {
+			return token, nil
+		}
+		if !errors.Is(err, jwt.ErrKeyNotFound) || !keySets.tryRefresh(cfg.JWKSURL) {
+			return nil, fmt.Errorf("could not verify the JWT: %w", err)
+		}
+		cfg.Logf("oauth2cli: fetching the key set again because the cached one does not have the key of the JWT")
+	}
+	keySet, err := fetchKeySet(ctx, cfg.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	keySets.put(cfg.JWKSURL, keySet)
+	if err := keySet.Verify(token); err != nil {
+		return nil, fmt.Errorf("could not verify the JWT: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,65 @@
+package oauth2cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLockTimeout is returned when the lock of Config.LockFile is not acquired within Config.LockTimeout.
+var ErrLockTimeout = errors.New("timed out waiting for the lock")
+
+// lockRetryInterval is the interval to check the lock held by another process.
+const lockRetryInterval = 100 * time.Millisecond
+
+// fileLock represents an advisory lock of the lock file held by this process.
+type fileLock struct {
+	f *os.File
+}
+
+// acquireFileLock opens the lock file and acquires an exclusive advisory lock of the OS,
+// i.e., flock on Unix and LockFileEx on Windows.
+// If another process holds the lock, it waits until the lock is released, the timeout or the context is done.
+// The kernel releases the lock when the process exits, so a killed process never leaves the lock.
+func acquireFileLock(ctx context.Context, cfg *Config) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.LockFile), 0700); err != nil {
+		return nil, fmt.Errorf("could not create the directory of the lock file: %w", err)
+	}
+	f, err := os.OpenFile(cfg.LockFile, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the lock file: %w", err)
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, cfg.LockTimeout, ErrLockTimeout)
+	defer cancel()
+	waiting := false
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("could not lock the file: %w", err)
+		}
+		if locked {
+			return &fileLock{f: f}, nil
+		}
+		if !waiting {
+			cfg.Logf("oauth2cli: waiting for the lock file %s held by another process", cfg.LockFile)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, context.Cause(ctx)
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// release releases the lock.
+// The lock file is left, because removing it would race with another process which has opened it.
+func (l *fileLock) release() {
+	_ = unlockFile(l.f)
+	_ = l.f.Close()
+}
@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+package oauth2cli
+
+import (
+	"errors"
+	"os"
+)
+
+func tryLockFile(*os.File) (bool, error) {
+	return false, errors.ErrUnsupported
+}
+
+func unlockFile(*os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,142 @@
+package oauth2cli
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// DefaultLocalServerLogoutHTML is a default response body on logout success.
+const DefaultLocalServerLogoutHTML = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<title>Logged out</title>
+	<script>
+		window.close()
+	</script>
+	<style>
+		body {
+			background-color: #eee;
+			margin: 0;
+			padding: 0;
+			font-family: sans-serif;
+		}
+		.placeholder {
+			margin: 2em;
+			padding: 2em;
+			background-color: #fff;
+			border-radius: 1em;
+		}
+	</style>
+</head>
+<body>
+	<div class="placeholder">
+		<h1>Logged out</h1>
+		<p>You can close this window.</p>
+	</div>
+</body>
+</html>
+`
+
+// Logout performs the OpenID Connect RP-Initiated Logout to end the session of the provider.
+// See https://openid.net/specs/openid-connect-rpinitiated-1_0.html
+//
+// This performs the following steps:
+//
+//  1. Start a local server at the port.
+//  2. Open a browser and navigate it to the local server.
+//  3. Redirect the browser to EndSessionURL with id_token_hint and post_logout_redirect_uri.
+//  4. Receive the state via a redirect to the local server, and show LocalServerLogoutHTML.
+//
+// idTokenHint is the ID token previously issued, which is recommended by the spec.
+// The local server works with the same options as GetToken, such as LocalServerReadyChan.
+// Note that the post_logout_redirect_uri must be registered to the provider.
+func Logout(ctx context.Context, cfg Config, idTokenHint string) error {
+	if err := cfg.validateAndSetDefaults(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.EndSessionURL == "" {
+		return errors.New("invalid config: EndSessionURL must be set")
+	}
+	localServerListener, localServerURL, err := newLocalServerListener(&cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// The listener may be closed by the server. No need to check the error.
+		_ = localServerListener.Close()
+	}()
+	if cfg.PostLogoutRedirectURL == "" {
+		cfg.PostLogoutRedirectURL = localServerURL
+	}
+	localServerIndexURL, err := indexURLOf(cfg.PostLogoutRedirectURL)
+	if err != nil {
+		return fmt.Errorf("invalid PostLogoutRedirectURL: %w", err)
+	}
+	params := url.Values{
+		"client_id":                {cfg.OAuth2Config.ClientID},
+		"post_logout_redirect_uri": {cfg.PostLogoutRedirectURL},
+		"state":                    {cfg.State},
+	}
+	if idTokenHint != "" {
+		params.Set("id_token_hint", idTokenHint)
+	}
+
+	respCh := make(chan error)
+	handler := &logoutHandler{
+		config:        &cfg,
+		endSessionURL: appendQuery(cfg.EndSessionURL, params),
+		respCh:        respCh,
+	}
+	logoutErr, err := serveLocalServer(ctx, &cfg, localServerListener, localServerIndexURL, handler, respCh, nil)
+	if err != nil {
+		return fmt.Errorf("logout error: %w", err)
+	}
+	return logoutErr
+}
+
+type logoutHandler struct {
+	config        *Config
+	endSessionURL string
+	respCh        chan<- error // channel to send a response to
+	onceRespCh    sync.Once    // ensure send once
+}
+
+func (h *logoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	callbackPath := "/"
+	if u, err := url.Parse(h.config.PostLogoutRedirectURL); err == nil && u.Path != "" {
+		callbackPath = u.Path
+	}
+	q := r.URL.Query()
+	switch {
+	case r.Method == "GET" && r.URL.Path == callbackPath && q.Has("state"):
+		h.onceRespCh.Do(func() {
+			h.respCh <- h.handleLogoutResponse(w, q)
+		})
+	case r.Method == "GET" && r.URL.Path == "/":
+		h.config.Logf("oauth2cli: sending redirect to %s", h.endSessionURL)
+		http.Redirect(w, r, h.endSessionURL, http.StatusFound)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *logoutHandler) handleLogoutResponse(w http.ResponseWriter, q url.Values) error {
+	state := q.Get("state")
+	if subtle.ConstantTimeCompare([]byte(state), []byte(h.config.State)) != 1 {
+		http.Error(w, "logout error", http.StatusInternalServerError)
+		return fmt.Errorf("state does not match (wants %s but got %s)", h.config.State, state)
+	}
+	w.Header().Add("Content-Type", "text/html")
+	if _, err := fmt.Fprint(w, h.config.LocalServerLogoutHTML); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return fmt.Errorf("write error: %w", err)
+	}
+	return nil
+}
@@ -4,8 +4,15 @@ package oauth2cli
 
 import (
 	"context"
+	"crypto"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/int128/oauth2cli/oauth2params"
 	"golang.org/x/oauth2"
@@ -54,6 +61,62 @@ type Config struct {
 	// If the RedirectURL field is set, make sure it matches the LocalServerBindAddress and LocalServerCallbackPath.
 	OAuth2Config oauth2.Config
 
+	// Issuer identifier of the authorization server.
+	// This is used to verify the iss claim of a JWT issued by the authorization server,
+	// and the iss parameter of the authorization response to prevent mix-up attacks.
+	// See https://www.rfc-editor.org/rfc/rfc9207
+	// Default to none.
+	Issuer string
+
+	// Policy of the iss parameter in the authorization response.
+	// This is effective only if Issuer is set.
+	// Default to IssuerParameterOptional.
+	IssuerParameterPolicy IssuerParameterPolicy
+
+	// URL of the JSON Web Key Set of the authorization server.
+	// This is used to verify the signature of a JWT issued by the authorization server.
+	// Default to none.
+	JWKSURL string
+
+	// URL of the UserInfo endpoint of OpenID Connect.
+	// This is used by GetUserInfo.
+	// Default to none.
+	UserInfoURL string
+
+	// URL of the end_session_endpoint of OpenID Connect RP-Initiated Logout.
+	// This is used by Logout.
+	// Default to none.
+	EndSessionURL string
+
+	// URL of the token revocation endpoint.
+	// This is used by RevokeToken.
+	// See https://www.rfc-editor.org/rfc/rfc7009
+	// Default to none.
+	RevocationURL string
+
+	// URL of the token introspection endpoint.
+	// This is used by IntrospectToken.
+	// See https://www.rfc-editor.org/rfc/rfc7662
+	// Default to none.
+	IntrospectionURL string
+
+	// If true, IntrospectToken requests a JWT response of the introspection endpoint,
+	// and verifies it by the key set of JWKSURL.
+	// See https://www.rfc-editor.org/rfc/rfc9701
+	// Default to false.
+	IntrospectionJWTResponse bool
+
+	// URL of the client registration endpoint.
+	// This is used by RegisterClient.
+	// See https://www.rfc-editor.org/rfc/rfc7591
+	// Default to none.
+	RegistrationURL string
+
+	// Redirect URL after logout, i.e., post_logout_redirect_uri.
+	// If set, make sure it matches the LocalServerBindAddress and LocalServerCallbackPath.
+	// Default to http://localhost with the allocated port and LocalServerCallbackPath.
+	PostLogoutRedirectURL string
+
 	// Options for an authorization request.
 	// You can set oauth2.AccessTypeOffline or oauth2.S256ChallengeOption.
 	AuthCodeOptions []oauth2.AuthCodeOption
@@ -62,10 +125,104 @@ type Config struct {
 	// You can set oauth2.VerifierOption.
 	TokenRequestOptions []oauth2.AuthCodeOption
 
+	// If true, GetToken sends the code challenge of PKCE with S256.
+	// A code verifier is generated for each authorization request.
+	// See https://www.rfc-editor.org/rfc/rfc7636
+	// Default to false.
+	PKCE bool
+
 	// State parameter in the authorization request.
 	// Default to a string of random 32 bytes.
 	State string
 
+	// Nonce parameter in the authorization request of OpenID Connect.
+	// If set, GetToken checks the nonce claim of the ID token in the token response.
+	// The signature of the ID token is verified if Issuer and JWKSURL are set,
+	// otherwise it relies on the TLS connection to the token endpoint.
+	// See https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+	// Default to a string of random 32 bytes if OAuth2Config.Scopes contains openid.
+	Nonce string
+
+	// Maximum authentication age, i.e., max_age parameter in the authorization request.
+	// If set, GetToken checks the auth_time claim of the ID token, and returns *AuthTimeError if it is too old.
+	// To force the user to re-authenticate, set prompt=login to AuthCodeOptions instead.
+	// It must be a whole number of seconds, because max_age is in seconds.
+	// See https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
+	// Default to none.
+	MaxAge time.Duration
+
+	// Requested Authentication Context Class Reference values, i.e., acr_values parameter in the authorization request.
+	// If set, GetToken checks the acr claim of the ID token, and returns *ACRError if it is not one of the values.
+	// Default to none.
+	ACRValues []string
+
+	// Endpoint of Pushed Authorization Requests (PAR).
+	// If set, the local server pushes the authorization parameters to the endpoint with the client authentication,
+	// and then redirects the browser with only client_id and request_uri.
+	// The request_uri is pushed again if it has expired.
+	// See https://www.rfc-editor.org/rfc/rfc9126
+	// Default to none.
+	PushedAuthorizationRequestURL string
+
+	// Signer of the request object (JAR).
+	// If set, the authorization parameters are sent in a signed request JWT,
+	// by value or together with PushedAuthorizationRequestURL.
+	// The algorithm is determined by the key type, such as RS256 for RSA or ES256 for ECDSA P-256.
+	// See https://www.rfc-editor.org/rfc/rfc9101
+	// Default to none.
+	RequestObjectSigner crypto.Signer
+
+	// Key ID of RequestObjectSigner, which is set to the kid header of the request object.
+	// Default to none.
+	RequestObjectKeyID string
+
+	// Audience of the request object, i.e., the issuer identifier of the authorization server.
+	// Default to the origin of OAuth2Config.Endpoint.AuthURL.
+	RequestObjectAudience string
+
+	// If true, send response_mode=form_post in the authorization request,
+	// and the provider sends the authorization response by a POST request to the local server.
+	// The local server accepts a POST request on the callback path regardless of this field.
+	// See https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html
+	ResponseModeFormPost bool
+
+	// If true, send response_type=code id_token in the authorization request, i.e., the hybrid flow of OpenID Connect.
+	// The ID token in the authorization response is verified with the c_hash claim against the code,
+	// before the code is exchanged for a token.
+	// This implies response_mode=form_post, because the local server cannot receive the fragment.
+	// Issuer and JWKSURL are required.
+	// See https://openid.net/specs/openid-connect-core-1_0.html#HybridFlowAuth
+	ResponseTypeCodeIDToken bool
+
+	// Response mode of JWT Secured Authorization Response Mode (JARM).
+	// Set "jwt", "query.jwt" or "form_post.jwt".
+	// If set, this is sent as response_mode in the authorization request,
+	// and the local server receives the authorization response as a signed JWT in the response parameter.
+	// The signature is verified by the key set of JWKSURL, and iss, aud and exp claims are checked.
+	// Issuer and JWKSURL are required.
+	// See https://openid.net/specs/oauth-v2-jarm.html
+	// Default to none.
+	JARMResponseMode string
+
+	// Private key for DPoP (Demonstrating Proof of Possession).
+	// If set, a DPoP proof is sent in the token request, and the provider issues a token bound to the key.
+	// Use DPoPTransport with the same key to access the resource server by the token.
+	// See https://www.rfc-editor.org/rfc/rfc9449
+	// Default to none.
+	DPoPKey crypto.Signer
+
+	// If true, send the JWK thumbprint of DPoPKey as dpop_jkt in the authorization request,
+	// to bind the authorization code to the key.
+	DPoPBindAuthorizationCode bool
+
+	// Resource indicators of the target services, which are sent as resource parameters.
+	// All resources are sent in the authorization request.
+	// If a single resource is given, it is also sent in the token request.
+	// Use GetTokensForResources to get an access token for each resource.
+	// See https://www.rfc-editor.org/rfc/rfc8707
+	// Default to none.
+	Resources []string
+
 	// Candidates of hostname and port which the local server binds to.
 	// You can set port number to 0 to allocate a free port.
 	// If multiple addresses are given, it will try the ports in order.
@@ -91,6 +248,10 @@ type Config struct {
 	// Default to DefaultLocalServerSuccessHTML.
 	LocalServerSuccessHTML string
 
+	// Response HTML body on logout completed.
+	// Default to DefaultLocalServerLogoutHTML.
+	LocalServerLogoutHTML string
+
 	// Middleware for the local server.
 	// Default to none.
 	LocalServerMiddleware func(h http.Handler) http.Handler
@@ -99,12 +260,67 @@ type Config struct {
 	// Default to none.
 	LocalServerReadyChan chan<- string
 
+	// Reader of the redirect URL pasted by the user, such as os.Stdin.
+	// If set, the redirect URL is read from the reader in parallel with the local server.
+	// This is useful when the browser cannot reach the local server, such as a remote host via SSH.
+	// The user can paste the URL in the address bar of the browser after the redirect.
+	// Whichever comes first is used, and it is validated in the same way.
+	// Note that reading the reader cannot be canceled,
+	// so it may continue in background until a line is read or EOF.
+	// Default to none.
+	RedirectURLReader io.Reader
+
 	// Redirect URL upon successful login
 	SuccessRedirectURL string
 
 	// Redirect URL upon failed login
 	FailureRedirectURL string
 
+	// Function to show the user code and verification URI to the user.
+	// This is called by GetTokenByDeviceAuthorization before polling the token endpoint.
+	// If this returns an error, the flow is aborted.
+	DeviceAuthorizationHandler func(ctx context.Context, resp *oauth2.DeviceAuthResponse) error
+
+	// Cache of the token, such as FileTokenCache.
+	// If set, GetToken returns the cached token without starting the local server if it is valid,
+	// and saves a new token to the cache.
+	// NewTokenSource also refreshes the cached token and saves it.
+	// Default to none.
+	TokenCache TokenCache
+
+	// Name of the profile, i.e., an account of the user such as personal or admin.
+	// If set, the token is cached for each profile.
+	// If ProfileStore is set, GetToken sends login_hint of the profile.
+	// If Issuer and JWKSURL are also set, GetToken verifies the ID token,
+	// checks the account against the profile, and stores sub and email of the ID token.
+	// Otherwise, GetToken logs a warning and skips the account check.
+	// Default to the current profile of ProfileStore, or none.
+	Profile string
+
+	// Store of the profiles.
+	// Default to none.
+	ProfileStore *ProfileStore
+
+	// Policy when the user signs in with another account than the profile expects.
+	// Default to AccountMismatchFail.
+	AccountMismatchPolicy AccountMismatchPolicy
+
+	// Path to a lock file to run the interactive flow in only one process at a time.
+	// If set, GetToken acquires an advisory lock of the file (flock or LockFileEx) before starting the local server,
+	// and the other processes wait until it is released.
+	// After the lock is acquired, GetToken loads TokenCache again,
+	// so that the waiting processes use the token saved by the first process.
+	// The OS releases the lock when the process exits, even if it has been killed.
+	// The file is left after the lock is released.
+	// TokenCache must be set, otherwise the waiting processes would start the flow again.
+	// Default to none.
+	LockFile string
+
+	// Timeout to wait for the lock of LockFile.
+	// If it is exceeded, GetToken returns an error wrapping ErrLockTimeout.
+	// Default to 5 minutes.
+	LockTimeout time.Duration
+
 	// Logger function for debug.
 	Logf func(format string, args ...interface{})
 }
@@ -113,11 +329,104 @@ func (cfg *Config) isLocalServerHTTPS() bool {
 	return cfg.LocalServerCertFile != "" && cfg.LocalServerKeyFile != ""
 }
 
+// authCodeURL returns the URL of the authorization request.
+func (cfg *Config) authCodeURL() (string, error) {
+	var opts []oauth2.AuthCodeOption
+	opts = append(opts, cfg.AuthCodeOptions...)
+	if cfg.Nonce != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", cfg.Nonce))
+	}
+	if cfg.MaxAge > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("max_age", strconv.FormatInt(int64(cfg.MaxAge/time.Second), 10)))
+	}
+	if len(cfg.ACRValues) > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("acr_values", strings.Join(cfg.ACRValues, " ")))
+	}
+	if cfg.ResponseTypeCodeIDToken {
+		opts = append(opts, oauth2.SetAuthURLParam("response_type", "code id_token"))
+	}
+	if cfg.ResponseModeFormPost || cfg.ResponseTypeCodeIDToken {
+		opts = append(opts, oauth2.SetAuthURLParam("response_mode", "form_post"))
+	}
+	if cfg.JARMResponseMode != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("response_mode", cfg.JARMResponseMode))
+	}
+	if cfg.DPoPKey != nil && cfg.DPoPBindAuthorizationCode {
+		jkt, err := dpopThumbprint(cfg.DPoPKey)
+		if err != nil {
+			return "", err
+		}
+		opts = append(opts, oauth2.SetAuthURLParam("dpop_jkt", jkt))
+	}
+	authCodeURL := cfg.OAuth2Config.AuthCodeURL(cfg.State, opts...)
+	if len(cfg.Resources) > 0 {
+		// oauth2.SetAuthURLParam cannot set multiple values.
+		authCodeURL = appendQuery(authCodeURL, url.Values{"resource": cfg.Resources})
+	}
+	return authCodeURL, nil
+}
+
+// tokenRequestOptions returns the options of the token request.
+func (cfg *Config) tokenRequestOptions() []oauth2.AuthCodeOption {
+	var opts []oauth2.AuthCodeOption
+	opts = append(opts, cfg.TokenRequestOptions...)
+	if len(cfg.Resources) == 1 {
+		opts = append(opts, oauth2.SetAuthURLParam("resource", cfg.Resources[0]))
+	}
+	return opts
+}
+
+// authorizationRequestParams returns the parameters of the authorization request,
+// i.e., the query parameters of authCodeURL.
+func (cfg *Config) authorizationRequestParams() (url.Values, error) {
+	rawURL, err := cfg.authCodeURL()
+	if err != nil {
+		return nil, err
+	}
+	authCodeURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization URL: %w", err)
+	}
+	return authCodeURL.Query(), nil
+}
+
 func (cfg *Config) validateAndSetDefaults() error {
 	if (cfg.LocalServerCertFile != "" && cfg.LocalServerKeyFile == "") ||
 		(cfg.LocalServerCertFile == "" && cfg.LocalServerKeyFile != "") {
 		return fmt.Errorf("both LocalServerCertFile and LocalServerKeyFile must be set")
 	}
+	if cfg.JARMResponseMode != "" {
+		switch cfg.JARMResponseMode {
+		case "jwt", "query.jwt", "form_post.jwt":
+		default:
+			return fmt.Errorf("unknown JARMResponseMode %s", cfg.JARMResponseMode)
+		}
+		if cfg.ResponseModeFormPost {
+			return fmt.Errorf("JARMResponseMode and ResponseModeFormPost are exclusive")
+		}
+		if cfg.Issuer == "" || cfg.JWKSURL == "" {
+			return fmt.Errorf("both Issuer and JWKSURL must be set for JARMResponseMode")
+		}
+	}
+	if cfg.ResponseTypeCodeIDToken {
+		if cfg.JARMResponseMode != "" {
+			return fmt.Errorf("JARMResponseMode and ResponseTypeCodeIDToken are exclusive")
+		}
+		if cfg.Issuer == "" || cfg.JWKSURL == "" {
+			return fmt.Errorf("both Issuer and JWKSURL must be set for ResponseTypeCodeIDToken")
+		}
+	}
+	if cfg.DPoPKey != nil {
+		if _, err := dpopThumbprint(cfg.DPoPKey); err != nil {
+			return err
+		}
+	}
+	if cfg.MaxAge < 0 || cfg.MaxAge%time.Second != 0 {
+		return fmt.Errorf("MaxAge must be a whole number of seconds but was %s", cfg.MaxAge)
+	}
+	if cfg.LockFile != "" && cfg.TokenCache == nil {
+		return fmt.Errorf("TokenCache must be set for LockFile")
+	}
 	if cfg.State == "" {
 		state, err := oauth2params.NewState()
 		if err != nil {
@@ -131,6 +440,12 @@ func (cfg *Config) validateAndSetDefaults() error {
 	if cfg.LocalServerSuccessHTML == "" {
 		cfg.LocalServerSuccessHTML = DefaultLocalServerSuccessHTML
 	}
+	if cfg.LocalServerLogoutHTML == "" {
+		cfg.LocalServerLogoutHTML = DefaultLocalServerLogoutHTML
+	}
+	if cfg.LockTimeout == 0 {
+		cfg.LockTimeout = 5 * time.Minute
+	}
 	if (cfg.SuccessRedirectURL != "" && cfg.FailureRedirectURL == "") ||
 		(cfg.SuccessRedirectURL == "" && cfg.FailureRedirectURL != "") {
 		return fmt.Errorf("when using success and failure redirect URLs, set both URLs")
@@ -153,17 +468,95 @@ func (cfg *Config) validateAndSetDefaults() error {
 //  5. Exchange the code and a token.
 //  6. Return the code.
 func GetToken(ctx context.Context, cfg Config) (*oauth2.Token, error) {
+	token, _, err := getToken(ctx, &cfg)
+	return token, err
+}
+
+// getToken performs the Authorization Code Grant Flow.
+// It returns the ID token if it is verified on the check of nonce, auth_time or acr.
+func getToken(ctx context.Context, cfg *Config) (*oauth2.Token, *IDToken, error) {
 	if err := cfg.validateAndSetDefaults(); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
 	}
-	code, err := receiveCodeViaLocalServer(ctx, &cfg)
+	profile, err := cfg.resolveProfile()
 	if err != nil {
-		return nil, fmt.Errorf("authorization error: %w", err)
+		return nil, nil, fmt.Errorf("could not load the profile: %w", err)
+	}
+	if cfg.TokenCache != nil {
+		if token, idToken := validCachedToken(ctx, cfg); token != nil {
+			return token, idToken, nil
+		}
+	}
+	if profile != nil && profile.LoginHint != "" {
+		cfg.AuthCodeOptions = append(slices.Clip(cfg.AuthCodeOptions), oauth2.SetAuthURLParam("login_hint", profile.LoginHint))
+	}
+	if cfg.LockFile != "" {
+		lock, err := acquireFileLock(ctx, cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not acquire the lock: %w", err)
+		}
+		defer lock.release()
+		// Another process may have saved the token while waiting for the lock.
+		if cfg.TokenCache != nil {
+			if token, idToken := validCachedToken(ctx, cfg); token != nil {
+				return token, idToken, nil
+			}
+		}
+	}
+	if cfg.Nonce == "" && (cfg.ResponseTypeCodeIDToken || slices.Contains(cfg.OAuth2Config.Scopes, "openid")) {
+		nonce, err := oauth2params.NewNonce()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not generate a nonce parameter: %w", err)
+		}
+		cfg.Nonce = nonce
+	}
+	if cfg.PKCE {
+		verifier := oauth2.GenerateVerifier()
+		cfg.AuthCodeOptions = append(slices.Clip(cfg.AuthCodeOptions), oauth2.S256ChallengeOption(verifier))
+		cfg.TokenRequestOptions = append(slices.Clip(cfg.TokenRequestOptions), oauth2.VerifierOption(verifier))
+	}
+	resp, err := receiveCodeViaLocalServer(ctx, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("authorization error: %w", err)
 	}
 	cfg.Logf("oauth2cli: exchanging the code and token")
-	token, err := cfg.OAuth2Config.Exchange(ctx, code, cfg.TokenRequestOptions...)
+	exchangeCtx := ctx
+	if cfg.DPoPKey != nil {
+		exchangeCtx = withDPoPClient(ctx, cfg.DPoPKey)
+	}
+	token, err := cfg.OAuth2Config.Exchange(exchangeCtx, resp.code, cfg.tokenRequestOptions()...)
 	if err != nil {
-		return nil, fmt.Errorf("could not exchange the code and token: %w", err)
+		return nil, nil, fmt.Errorf("could not exchange the code and token: %w", err)
+	}
+	var idToken *IDToken
+	if cfg.Nonce != "" || cfg.MaxAge > 0 || len(cfg.ACRValues) > 0 {
+		idToken, err = verifyTokenResponseIDToken(ctx, cfg, token)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.idToken != nil {
+			if err := verifySameSubject(resp.idToken, idToken); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	accountMatched := true
+	if profile != nil {
+		if cfg.Issuer != "" && cfg.JWKSURL != "" {
+			if idToken == nil {
+				if idToken, err = verifyIDToken(ctx, cfg, token); err != nil {
+					return nil, nil, err
+				}
+			}
+			if accountMatched, err = verifyAccount(cfg, profile, idToken); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			cfg.Logf("oauth2cli: warning: skipped the account check of the profile %s because Issuer or JWKSURL is not set", profile.Name)
+		}
+	}
+	if cfg.TokenCache != nil && accountMatched {
+		saveCachedToken(cfg, token)
 	}
-	return token, nil
+	return token, idToken, nil
 }
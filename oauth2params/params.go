@@ -1,4 +1,4 @@
-// Package oauth2params provides the generators of parameters such as state and PKCE.
+// Package oauth2params provides the generators of parameters such as state, nonce and PKCE.
 package oauth2params
 
 import (
@@ -18,6 +18,17 @@ func NewState() (string, error) {
 	return base64URLEncode(b), nil
 }
 
+// NewNonce returns a nonce parameter of OpenID Connect.
+// This generates 256 bits of random bytes.
+// See https://openid.net/specs/openid-connect-core-1_0.html#NonceNotes
+func NewNonce() (string, error) {
+	b, err := random(32)
+	if err != nil {
+		return "", fmt.Errorf("could not generate a random: %w", err)
+	}
+	return base64URLEncode(b), nil
+}
+
 func random(bits int) ([]byte, error) {
 	b := make([]byte, bits)
 	if err := binary.Read(rand.Reader, binary.LittleEndian, b); err != nil {
@@ -0,0 +1,270 @@
+package oauth2cli
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/int128/oauth2cli/internal/jwt"
+	"golang.org/x/oauth2"
+)
+
+// IDToken represents a verified ID token of OpenID Connect.
+// See https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type IDToken struct {
+	// Raw ID token.
+	Raw string
+
+	Issuer          string
+	Subject         string
+	Audience        []string
+	Expiry          time.Time
+	IssuedAt        time.Time
+	AuthorizedParty string
+	Nonce           string
+	AuthTime        time.Time // zero if auth_time is not present
+	ACR             string
+
+	algorithm string
+	payload   []byte
+}
+
+// Claims decodes the claims of the ID token into v.
+// This is useful to get the claims which are not contained in IDToken, such as email.
+func (t *IDToken) Claims(v any) error {
+	return (&jwt.Token{Payload: t.payload}).Claims(v)
+}
+
+// IDTokenVerificationError represents an error on verification of the ID token.
+// Use errors.As to check the claim which failed the verification.
+type IDTokenVerificationError struct {
+	// Claim which failed the verification, such as iss or exp.
+	// Empty if the ID token is missing or the signature is invalid.
+	Claim string
+
+	Err error
+}
+
+func (e *IDTokenVerificationError) Error() string {
+	return fmt.Sprintf("invalid ID token: %s", e.Err)
+}
+
+func (e *IDTokenVerificationError) Unwrap() error {
+	return e.Err
+}
+
+// AuthTimeError is returned when auth_time of the ID token is older than Config.MaxAge.
+// It is wrapped in *IDTokenVerificationError.
+// The caller can retry the login with prompt=login to re-authenticate the user.
+type AuthTimeError struct {
+	AuthTime time.Time // zero if auth_time is not present
+	MaxAge   time.Duration
+}
+
+func (e *AuthTimeError) Error() string {
+	if e.AuthTime.IsZero() {
+		return "auth_time is missing"
+	}
+	return fmt.Sprintf("the user has authenticated at %s, which is older than max_age %s", e.AuthTime, e.MaxAge)
+}
+
+// ACRError is returned when acr of the ID token is not one of Config.ACRValues.
+// It is wrapped in *IDTokenVerificationError.
+// The caller can retry the login with prompt=login to re-authenticate the user, e.g., with MFA.
+type ACRError struct {
+	ACR       string // empty if acr is not present
+	ACRValues []string
+}
+
+func (e *ACRError) Error() string {
+	return fmt.Sprintf("acr %q is not one of %v", e.ACR, e.ACRValues)
+}
+
+type idTokenClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        jwt.Audience `json:"aud"`
+	Expiry          int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	AuthorizedParty string       `json:"azp"`
+	Nonce           string       `json:"nonce"`
+	AuthTime        int64        `json:"auth_time"`
+	ACR             string       `json:"acr"`
+}
+
+// GetTokenWithIDToken performs GetToken and verifies the ID token in the token response.
+// It returns the token and the verified ID token.
+// Issuer and JWKSURL are required.
+// If the ID token is missing or invalid, it returns an error of *IDTokenVerificationError.
+func GetTokenWithIDToken(ctx context.Context, cfg Config) (*oauth2.Token, *IDToken, error) {
+	if cfg.Issuer == "" || cfg.JWKSURL == "" {
+		return nil, nil, errors.New("invalid config: both Issuer and JWKSURL must be set")
+	}
+	token, idToken, err := getToken(ctx, &cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if idToken != nil {
+		// already verified on the check of the token response
+		return token, idToken, nil
+	}
+	idToken, err = verifyIDToken(ctx, &cfg, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, idToken, nil
+}
+
+// VerifyIDToken verifies the ID token in the token response.
+// This is useful to verify the ID token of a refreshed token.
+// Issuer and JWKSURL are required.
+//
+// This verifies the signature by the key set of JWKSURL, and iss, aud, exp, iat and azp claims.
+// If Nonce, MaxAge or ACRValues is set, this also verifies nonce, auth_time or acr claim respectively.
+// The key set is cached in memory, and fetched again when the keys are rotated.
+// See https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+//
+// If the ID token is missing or invalid, it returns an error of *IDTokenVerificationError.
+func VerifyIDToken(ctx context.Context, cfg Config, token *oauth2.Token) (*IDToken, error) {
+	if err := cfg.validateAndSetDefaults(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.Issuer == "" || cfg.JWKSURL == "" {
+		return nil, errors.New("invalid config: both Issuer and JWKSURL must be set")
+	}
+	return verifyIDToken(ctx, &cfg, token)
+}
+
+func verifyIDToken(ctx context.Context, cfg *Config, token *oauth2.Token) (*IDToken, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, &IDTokenVerificationError{Err: errors.New("id_token is missing in the token response")}
+	}
+	return verifyRawIDToken(ctx, cfg, rawIDToken)
+}
+
+func verifyRawIDToken(ctx context.Context, cfg *Config, rawIDToken string) (*IDToken, error) {
+	jwtToken, err := verifyJWT(ctx, cfg, rawIDToken)
+	if err != nil {
+		return nil, &IDTokenVerificationError{Err: err}
+	}
+	var claims idTokenClaims
+	if err := jwtToken.Claims(&claims); err != nil {
+		return nil, &IDTokenVerificationError{Err: err}
+	}
+	if claims.Issuer != cfg.Issuer {
+		return nil, &IDTokenVerificationError{Claim: "iss",
+			Err: fmt.Errorf("iss does not match (wants %s but got %s)", cfg.Issuer, claims.Issuer)}
+	}
+	if err := verifyAudienceClaims(cfg, &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if claims.Expiry == 0 {
+		return nil, &IDTokenVerificationError{Claim: "exp", Err: errors.New("exp is missing")}
+	}
+	if now.Add(-allowedClockSkew).After(time.Unix(claims.Expiry, 0)) {
+		return nil, &IDTokenVerificationError{Claim: "exp",
+			Err: fmt.Errorf("the ID token has expired at %s", time.Unix(claims.Expiry, 0))}
+	}
+	if claims.IssuedAt == 0 {
+		return nil, &IDTokenVerificationError{Claim: "iat", Err: errors.New("iat is missing")}
+	}
+	if now.Add(allowedClockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return nil, &IDTokenVerificationError{Claim: "iat",
+			Err: fmt.Errorf("the ID token is issued in the future at %s", time.Unix(claims.IssuedAt, 0))}
+	}
+	if err := verifyAuthenticationClaims(cfg, &claims); err != nil {
+		return nil, err
+	}
+	var authTime time.Time
+	if claims.AuthTime != 0 {
+		authTime = time.Unix(claims.AuthTime, 0)
+	}
+	return &IDToken{
+		Raw:             rawIDToken,
+		Issuer:          claims.Issuer,
+		Subject:         claims.Subject,
+		Audience:        claims.Audience,
+		Expiry:          time.Unix(claims.Expiry, 0),
+		IssuedAt:        time.Unix(claims.IssuedAt, 0),
+		AuthorizedParty: claims.AuthorizedParty,
+		Nonce:           claims.Nonce,
+		AuthTime:        authTime,
+		ACR:             claims.ACR,
+		algorithm:       jwtToken.Header.Algorithm,
+		payload:         jwtToken.Payload,
+	}, nil
+}
+
+// verifyAudienceClaims verifies that aud contains the client ID and azp is the client ID if present.
+func verifyAudienceClaims(cfg *Config, claims *idTokenClaims) error {
+	clientID := cfg.OAuth2Config.ClientID
+	if !claims.Audience.Contains(clientID) {
+		return &IDTokenVerificationError{Claim: "aud",
+			Err: fmt.Errorf("aud does not contain the client ID %s", clientID)}
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty == "" {
+		return &IDTokenVerificationError{Claim: "azp",
+			Err: errors.New("azp is required for multiple audiences")}
+	}
+	if claims.AuthorizedParty != "" && claims.AuthorizedParty != clientID {
+		return &IDTokenVerificationError{Claim: "azp",
+			Err: fmt.Errorf("azp does not match (wants %s but got %s)", clientID, claims.AuthorizedParty)}
+	}
+	return nil
+}
+
+// verifyTokenResponseIDToken verifies the claims of the ID token in the token response,
+// which are requested by the authorization request, i.e., nonce, auth_time and acr.
+// If Issuer and JWKSURL are set, it verifies the ID token and returns it.
+// Otherwise, it checks only aud, azp and the requested claims, because the ID token is received
+// directly from the token endpoint via TLS.
+// See https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+func verifyTokenResponseIDToken(ctx context.Context, cfg *Config, token *oauth2.Token) (*IDToken, error) {
+	if cfg.Issuer != "" && cfg.JWKSURL != "" {
+		return verifyIDToken(ctx, cfg, token)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, &IDTokenVerificationError{Err: errors.New("id_token is missing in the token response")}
+	}
+	jwtToken, err := jwt.Parse(rawIDToken)
+	if err != nil {
+		return nil, &IDTokenVerificationError{Err: err}
+	}
+	var claims idTokenClaims
+	if err := jwtToken.Claims(&claims); err != nil {
+		return nil, &IDTokenVerificationError{Err: err}
+	}
+	if err := verifyAudienceClaims(cfg, &claims); err != nil {
+		return nil, err
+	}
+	if err := verifyAuthenticationClaims(cfg, &claims); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// verifyAuthenticationClaims verifies nonce, auth_time and acr claims if they are requested.
+func verifyAuthenticationClaims(cfg *Config, claims *idTokenClaims) error {
+	if cfg.Nonce != "" && subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(cfg.Nonce)) != 1 {
+		return &IDTokenVerificationError{Claim: "nonce", Err: errors.New("nonce does not match")}
+	}
+	if cfg.MaxAge > 0 {
+		if claims.AuthTime == 0 {
+			return &IDTokenVerificationError{Claim: "auth_time", Err: &AuthTimeError{MaxAge: cfg.MaxAge}}
+		}
+		authTime := time.Unix(claims.AuthTime, 0)
+		if time.Since(authTime) > cfg.MaxAge+allowedClockSkew {
+			return &IDTokenVerificationError{Claim: "auth_time", Err: &AuthTimeError{AuthTime: authTime, MaxAge: cfg.MaxAge}}
+		}
+	}
+	if len(cfg.ACRValues) > 0 && !slices.Contains(cfg.ACRValues, claims.ACR) {
+		return &IDTokenVerificationError{Claim: "acr", Err: &ACRError{ACR: claims.ACR, ACRValues: cfg.ACRValues}}
+	}
+	return nil
+}
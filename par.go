@@ -0,0 +1,52 @@
+package oauth2cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// pushedAuthorizationResponse represents a response of Pushed Authorization Request.
+// See https://www.rfc-editor.org/rfc/rfc9126#section-2.2
+type pushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
+
+// pushedAuthorizationRequest holds a request_uri issued by the authorization server.
+type pushedAuthorizationRequest struct {
+	requestURI string
+	expiry     time.Time
+}
+
+// pushedAuthorizationRequestExpiryDelta is the margin to refresh a request_uri before it expires,
+// considering the time to navigate the browser to the authorization server.
+const pushedAuthorizationRequestExpiryDelta = 5 * time.Second
+
+func (par *pushedAuthorizationRequest) valid() bool {
+	return par != nil && time.Now().Add(pushedAuthorizationRequestExpiryDelta).Before(par.expiry)
+}
+
+// pushAuthorizationRequest sends the authorization parameters to the PAR endpoint.
+// See https://www.rfc-editor.org/rfc/rfc9126
+func pushAuthorizationRequest(ctx context.Context, cfg *Config, params url.Values) (*pushedAuthorizationRequest, error) {
+	cfg.Logf("oauth2cli: pushing the authorization request to %s", cfg.PushedAuthorizationRequestURL)
+	_, body, err := postForm(ctx, &cfg.OAuth2Config, cfg.PushedAuthorizationRequestURL, params)
+	if err != nil {
+		return nil, fmt.Errorf("pushed authorization request error: %w", err)
+	}
+	var resp pushedAuthorizationResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid pushed authorization response: %w", err)
+	}
+	if resp.RequestURI == "" {
+		return nil, errors.New("invalid pushed authorization response: request_uri is missing")
+	}
+	return &pushedAuthorizationRequest{
+		requestURI: resp.RequestURI,
+		expiry:     time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,260 @@
+package oauth2cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrAccountMismatch is returned when the user signed in with another account than the profile expects,
+// e.g., the browser has a session of another account.
+var ErrAccountMismatch = errors.New("account does not match the profile")
+
+// AccountMismatchPolicy represents how to handle a login of another account than the profile expects.
+type AccountMismatchPolicy int
+
+const (
+	// AccountMismatchFail returns an error wrapping ErrAccountMismatch.
+	// The token is not saved to the cache.
+	AccountMismatchFail AccountMismatchPolicy = iota
+
+	// AccountMismatchWarn logs a warning by Config.Logf and returns the token.
+	// The token is not saved to the cache, so that the cache of the profile holds only the token of the account.
+	AccountMismatchWarn
+)
+
+// Profile represents an account of the user at the provider, such as personal or admin.
+type Profile struct {
+	Name string `json:"name"`
+
+	// login_hint parameter in the authorization request, such as an email address.
+	// If Subject is not known yet and this is an email address, it is compared with the email claim of the ID token.
+	LoginHint string `json:"login_hint,omitempty"`
+
+	// sub and email claims of the ID token, which are stored on the first login.
+	// The subsequent logins are checked against Subject.
+	Subject string `json:"sub,omitempty"`
+	Email   string `json:"email,omitempty"`
+}
+
+// ProfileStore stores the profiles and the current profile in a JSON file.
+// The file is readable only by the owner, and written atomically by renaming a temporary file.
+type ProfileStore struct {
+	// Path to the JSON file.
+	// The directory is created with the permission 0700 if it does not exist.
+	File string
+}
+
+type profileStoreFile struct {
+	Current  string    `json:"current,omitempty"`
+	Profiles []Profile `json:"profiles"`
+}
+
+func (s *ProfileStore) read() (*profileStoreFile, error) {
+	b, err := os.ReadFile(s.File)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &profileStoreFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the profiles: %w", err)
+	}
+	var f profileStoreFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("invalid profiles %s: %w", s.File, err)
+	}
+	return &f, nil
+}
+
+func (s *ProfileStore) write(f *profileStoreFile) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode the profiles: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.File), 0700); err != nil {
+		return fmt.Errorf("could not create the directory of the profiles: %w", err)
+	}
+	if err := writeFileAtomically(s.File, b); err != nil {
+		return fmt.Errorf("could not write the profiles: %w", err)
+	}
+	return nil
+}
+
+// List returns the profiles sorted by the name.
+func (s *ProfileStore) List() ([]Profile, error) {
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	profiles := slices.Clone(f.Profiles)
+	slices.SortFunc(profiles, func(a, b Profile) int { return strings.Compare(a.Name, b.Name) })
+	return profiles, nil
+}
+
+// Get returns the profile of the name.
+// It returns nil and no error if the profile is not found.
+func (s *ProfileStore) Get(name string) (*Profile, error) {
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(f.Profiles, func(p Profile) bool { return p.Name == name })
+	if i < 0 {
+		return nil, nil
+	}
+	return &f.Profiles[i], nil
+}
+
+// Current returns the name of the current profile.
+// It returns an empty string if no profile is selected.
+func (s *ProfileStore) Current() (string, error) {
+	f, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	return f.Current, nil
+}
+
+// Put adds or replaces the profile of the same name.
+// The first profile becomes the current profile.
+func (s *ProfileStore) Put(profile Profile) error {
+	if profile.Name == "" {
+		return errors.New("name of the profile must be set")
+	}
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	if i := slices.IndexFunc(f.Profiles, func(p Profile) bool { return p.Name == profile.Name }); i >= 0 {
+		f.Profiles[i] = profile
+	} else {
+		f.Profiles = append(f.Profiles, profile)
+	}
+	if f.Current == "" {
+		f.Current = profile.Name
+	}
+	return s.write(f)
+}
+
+// Switch sets the current profile.
+func (s *ProfileStore) Switch(name string) error {
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(f.Profiles, func(p Profile) bool { return p.Name == name }) {
+		return fmt.Errorf("profile %s not found", name)
+	}
+	f.Current = name
+	return s.write(f)
+}
+
+// Remove removes the profile.
+// If it is the current profile, no profile is selected.
+// Use RemoveProfile to remove the cached token as well.
+func (s *ProfileStore) Remove(name string) error {
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	f.Profiles = slices.DeleteFunc(f.Profiles, func(p Profile) bool { return p.Name == name })
+	if f.Current == name {
+		f.Current = ""
+	}
+	return s.write(f)
+}
+
+// RemoveProfile removes the cached token of the profile and the profile in ProfileStore.
+// Note that this does not revoke the token. Use RevokeToken before removing the profile.
+func RemoveProfile(cfg Config, name string) error {
+	cfg.Profile = name
+	if cfg.TokenCache != nil {
+		if err := cfg.TokenCache.Delete(TokenCacheKeyOf(cfg)); err != nil {
+			return fmt.Errorf("could not remove the cached token: %w", err)
+		}
+	}
+	if cfg.ProfileStore != nil {
+		if err := cfg.ProfileStore.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveProfile sets the current profile of ProfileStore to Profile if not set,
+// and returns the stored profile.
+// It returns a new profile if it is not stored yet, or nil if ProfileStore is not set.
+func (cfg *Config) resolveProfile() (*Profile, error) {
+	if cfg.ProfileStore == nil {
+		return nil, nil
+	}
+	if cfg.Profile == "" {
+		current, err := cfg.ProfileStore.Current()
+		if err != nil {
+			return nil, err
+		}
+		if current == "" {
+			return nil, nil
+		}
+		cfg.Profile = current
+	}
+	profile, err := cfg.ProfileStore.Get(cfg.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return &Profile{Name: cfg.Profile}, nil
+	}
+	return profile, nil
+}
+
+type accountClaims struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+}
+
+// verifyAccount checks the account of the verified ID token against the profile,
+// and stores sub and email of the ID token to the profile.
+// It returns true if the account matches the profile.
+// On a mismatch, it returns false in AccountMismatchWarn, or an error wrapping ErrAccountMismatch.
+func verifyAccount(cfg *Config, profile *Profile, idToken *IDToken) (bool, error) {
+	var claims accountClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return false, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if mismatch := accountMismatchOf(profile, &claims); mismatch != "" {
+		if cfg.AccountMismatchPolicy == AccountMismatchWarn {
+			cfg.Logf("oauth2cli: warning: signed in with another account than the profile %s: %s", profile.Name, mismatch)
+			return false, nil
+		}
+		return false, fmt.Errorf("%w %s: %s", ErrAccountMismatch, profile.Name, mismatch)
+	}
+	if profile.Subject == claims.Subject && profile.Email == claims.Email {
+		return true, nil
+	}
+	profile.Subject = claims.Subject
+	profile.Email = claims.Email
+	if err := cfg.ProfileStore.Put(*profile); err != nil {
+		return false, fmt.Errorf("could not save the profile: %w", err)
+	}
+	return true, nil
+}
+
+// accountMismatchOf returns the description of the mismatch, or an empty string if the account matches.
+func accountMismatchOf(profile *Profile, claims *accountClaims) string {
+	if profile.Subject != "" {
+		if claims.Subject != profile.Subject {
+			return fmt.Sprintf("sub wants %s but got %s", profile.Subject, claims.Subject)
+		}
+		return ""
+	}
+	// login_hint may be a username or an opaque value. Compare it only if it is an email address.
+	if strings.Contains(profile.LoginHint, "@") && claims.Email != "" && !strings.EqualFold(claims.Email, profile.LoginHint) {
+		return fmt.Sprintf("email wants %s but got %s", profile.LoginHint, claims.Email)
+	}
+	return ""
+}
@@ -0,0 +1,250 @@
+package oauth2cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ClientMetadata represents the metadata of a client to register.
+// See https://www.rfc-editor.org/rfc/rfc7591#section-2
+// and https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata
+type ClientMetadata struct {
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	ApplicationType         string   `json:"application_type,omitempty"`
+	ClientName              string   `json:"client_name,omitempty"`
+	ClientURI               string   `json:"client_uri,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+	SoftwareID              string   `json:"software_id,omitempty"`
+	SoftwareVersion         string   `json:"software_version,omitempty"`
+}
+
+// ClientRegistration represents the client information response,
+// which contains the registered metadata and the credentials.
+// This can be stored as JSON by SaveClientRegistration.
+// See https://www.rfc-editor.org/rfc/rfc7591#section-3.2.1
+// and https://www.rfc-editor.org/rfc/rfc7592#section-3
+type ClientRegistration struct {
+	ClientMetadata
+
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at,omitempty"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri,omitempty"`
+}
+
+// Configure sets the client credentials to cfg.
+// OAuth2Config.Endpoint.AuthStyle is set by the token_endpoint_auth_method.
+func (r *ClientRegistration) Configure(cfg *Config) {
+	cfg.OAuth2Config.ClientID = r.ClientID
+	cfg.OAuth2Config.ClientSecret = r.ClientSecret
+	switch r.TokenEndpointAuthMethod {
+	case "client_secret_basic":
+		cfg.OAuth2Config.Endpoint.AuthStyle = oauth2.AuthStyleInHeader
+	case "client_secret_post", "none":
+		cfg.OAuth2Config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
+}
+
+// LoopbackRedirectURIs returns the redirect URIs which the local server may use.
+// It returns a URI for each port of LocalServerBindAddress, such as http://localhost:8000/callback.
+// If the port is 0 or LocalServerBindAddress is empty, it returns the port-agnostic URI,
+// such as http://localhost/callback, because the authorization server must allow any port
+// of a loopback redirect URI.
+// See https://www.rfc-editor.org/rfc/rfc8252#section-7.3
+func LoopbackRedirectURIs(cfg Config) []string {
+	scheme := "http"
+	if cfg.isLocalServerHTTPS() {
+		scheme = "https"
+	}
+	var redirectURIs []string
+	seen := make(map[string]bool)
+	add := func(host string) {
+		u := (&url.URL{Scheme: scheme, Host: host, Path: cfg.LocalServerCallbackPath}).String()
+		if !seen[u] {
+			seen[u] = true
+			redirectURIs = append(redirectURIs, u)
+		}
+	}
+	for _, address := range cfg.LocalServerBindAddress {
+		_, port, err := net.SplitHostPort(address)
+		if err != nil || port == "0" || port == "" {
+			add("localhost")
+			continue
+		}
+		add(net.JoinHostPort("localhost", port))
+	}
+	if len(redirectURIs) == 0 {
+		add("localhost")
+	}
+	return redirectURIs
+}
+
+// NewNativeClientMetadata returns the metadata of a public native client,
+// which uses the authorization code grant with the loopback redirect URIs of cfg.
+// See https://www.rfc-editor.org/rfc/rfc8252#section-8.4
+func NewNativeClientMetadata(cfg Config, clientName string) ClientMetadata {
+	return ClientMetadata{
+		RedirectURIs:            LoopbackRedirectURIs(cfg),
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		ResponseTypes:           []string{"code"},
+		ApplicationType:         "native",
+		ClientName:              clientName,
+	}
+}
+
+// RegisterClient registers a client to RegistrationURL of the authorization server.
+// NewConfigFromIssuer sets RegistrationURL to the registration_endpoint of the provider metadata.
+// initialAccessToken is optional, which is required by some authorization servers.
+// See https://www.rfc-editor.org/rfc/rfc7591#section-3
+func RegisterClient(ctx context.Context, cfg Config, metadata ClientMetadata, initialAccessToken string) (*ClientRegistration, error) {
+	if cfg.RegistrationURL == "" {
+		return nil, errors.New("invalid config: RegistrationURL must be set")
+	}
+	registration, err := doRegistrationRequest(ctx, http.MethodPost, cfg.RegistrationURL, initialAccessToken, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("client registration error: %w", err)
+	}
+	return registration, nil
+}
+
+// ReadClientRegistration retrieves the current registration of the client.
+// See https://www.rfc-editor.org/rfc/rfc7592#section-2.1
+func ReadClientRegistration(ctx context.Context, registration *ClientRegistration) (*ClientRegistration, error) {
+	if registration.RegistrationClientURI == "" {
+		return nil, errors.New("registration_client_uri is not available")
+	}
+	newRegistration, err := doRegistrationRequest(ctx, http.MethodGet,
+		registration.RegistrationClientURI, registration.RegistrationAccessToken, nil)
+	if err != nil {
+		return nil, fmt.Errorf("client read error: %w", err)
+	}
+	newRegistration.carryOverCredentials(registration)
+	return newRegistration, nil
+}
+
+// UpdateClientRegistration replaces the metadata of the client.
+// Note that the omitted fields may be reset to the default values by the authorization server.
+// See https://www.rfc-editor.org/rfc/rfc7592#section-2.2
+func UpdateClientRegistration(ctx context.Context, registration *ClientRegistration, metadata ClientMetadata) (*ClientRegistration, error) {
+	if registration.RegistrationClientURI == "" {
+		return nil, errors.New("registration_client_uri is not available")
+	}
+	body := struct {
+		ClientMetadata
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret,omitempty"`
+	}{
+		ClientMetadata: metadata,
+		ClientID:       registration.ClientID,
+		ClientSecret:   registration.ClientSecret,
+	}
+	newRegistration, err := doRegistrationRequest(ctx, http.MethodPut,
+		registration.RegistrationClientURI, registration.RegistrationAccessToken, body)
+	if err != nil {
+		return nil, fmt.Errorf("client update error: %w", err)
+	}
+	newRegistration.carryOverCredentials(registration)
+	return newRegistration, nil
+}
+
+// carryOverCredentials keeps the credentials which are omitted in the response,
+// i.e., the authorization server has not rotated them.
+func (r *ClientRegistration) carryOverCredentials(old *ClientRegistration) {
+	if r.ClientSecret == "" {
+		r.ClientSecret = old.ClientSecret
+		r.ClientSecretExpiresAt = old.ClientSecretExpiresAt
+	}
+	if r.RegistrationAccessToken == "" {
+		r.RegistrationAccessToken = old.RegistrationAccessToken
+	}
+	if r.RegistrationClientURI == "" {
+		r.RegistrationClientURI = old.RegistrationClientURI
+	}
+}
+
+// doRegistrationRequest sends the JSON body with the bearer token, and returns the client information response.
+// It returns an *oauth2.RetrieveError if the server responds an error.
+func doRegistrationRequest(ctx context.Context, method, endpointURL, accessToken string, body any) (*ClientRegistration, error) {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode the client metadata: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpointURL, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	_, respBody, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var registration ClientRegistration
+	if err := json.Unmarshal(respBody, &registration); err != nil {
+		return nil, fmt.Errorf("invalid client information response: %w", err)
+	}
+	if registration.ClientID == "" {
+		return nil, errors.New("invalid client information response: client_id is missing")
+	}
+	return &registration, nil
+}
+
+// SaveClientRegistration writes the registration to the file as JSON.
+// The file is readable only by the owner, because it contains the credentials.
+// It is written atomically by renaming a temporary file, so that a reader never sees a partially written file.
+func SaveClientRegistration(name string, registration *ClientRegistration) error {
+	b, err := json.MarshalIndent(registration, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode the client registration: %w", err)
+	}
+	if err := writeFileAtomically(name, b); err != nil {
+		return fmt.Errorf("could not write the client registration: %w", err)
+	}
+	return nil
+}
+
+// LoadClientRegistration reads the registration from the file written by SaveClientRegistration.
+// It returns an error wrapping os.ErrNotExist if the file does not exist, e.g., on first use.
+func LoadClientRegistration(name string) (*ClientRegistration, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the client registration: %w", err)
+	}
+	var registration ClientRegistration
+	if err := json.Unmarshal(b, &registration); err != nil {
+		return nil, fmt.Errorf("invalid client registration %s: %w", name, err)
+	}
+	return &registration, nil
+}
+
+// ClientSecretExpired returns true if the client secret has expired.
+// It returns false if the client secret does not expire.
+func (r *ClientRegistration) ClientSecretExpired() bool {
+	return r.ClientSecretExpiresAt != 0 && !time.Now().Before(time.Unix(r.ClientSecretExpiresAt, 0))
+}
@@ -0,0 +1,43 @@
+package oauth2cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
+
+// GetTokensForResources returns an access token for each resource of Config.Resources,
+// by the refresh token grant with the resource parameter.
+// This is useful to get the tokens of multiple audiences after the single interactive GetToken.
+// If the provider rotates the refresh token, the latest one is used for the subsequent requests.
+// The returned map is keyed by the resource URI.
+// See https://www.rfc-editor.org/rfc/rfc8707#section-2.2
+func GetTokensForResources(ctx context.Context, cfg Config, token *oauth2.Token) (map[string]*oauth2.Token, error) {
+	if token == nil || token.RefreshToken == "" {
+		return nil, errors.New("refresh token is required")
+	}
+	if cfg.DPoPKey != nil {
+		ctx = withDPoPClient(ctx, cfg.DPoPKey)
+	}
+	refreshToken := token.RefreshToken
+	tokens := make(map[string]*oauth2.Token, len(cfg.Resources))
+	for _, resource := range cfg.Resources {
+		resourceToken, err := retrieveToken(ctx, &cfg.OAuth2Config, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+			"resource":      {resource},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not get a token for the resource %s: %w", resource, err)
+		}
+		if resourceToken.RefreshToken == "" {
+			resourceToken.RefreshToken = refreshToken
+		}
+		refreshToken = resourceToken.RefreshToken
+		tokens[resource] = resourceToken
+	}
+	return tokens, nil
+}
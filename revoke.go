@@ -0,0 +1,49 @@
+package oauth2cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
+
+// RevokeToken revokes the refresh token and the access token of the token at RevocationURL.
+// The client is authenticated in the same way as the token request.
+// It revokes the refresh token first, because it may invalidate the access tokens as well.
+// The token_type_hint parameter is sent for each token.
+// See https://www.rfc-editor.org/rfc/rfc7009
+//
+// If the server responds an error, it returns an error wrapping *oauth2.RetrieveError,
+// such as unsupported_token_type if the server does not support revocation of access tokens.
+func RevokeToken(ctx context.Context, cfg Config, token *oauth2.Token) error {
+	if cfg.RevocationURL == "" {
+		return errors.New("invalid config: RevocationURL must be set")
+	}
+	if token == nil || (token.RefreshToken == "" && token.AccessToken == "") {
+		return errors.New("no token to revoke")
+	}
+	var errs []error
+	if token.RefreshToken != "" {
+		if err := revokeToken(ctx, &cfg, token.RefreshToken, "refresh_token"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if token.AccessToken != "" {
+		if err := revokeToken(ctx, &cfg, token.AccessToken, "access_token"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func revokeToken(ctx context.Context, cfg *Config, token, tokenTypeHint string) error {
+	if _, _, err := postForm(ctx, &cfg.OAuth2Config, cfg.RevocationURL, url.Values{
+		"token":           {token},
+		"token_type_hint": {tokenTypeHint},
+	}); err != nil {
+		return fmt.Errorf("could not revoke the %s: %w", tokenTypeHint, err)
+	}
+	return nil
+}
@@ -1,12 +1,16 @@
 package oauth2cli
 
 import (
+	"bufio"
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,45 +18,92 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-func receiveCodeViaLocalServer(ctx context.Context, cfg *Config) (string, error) {
-	localServerListener, err := listener.New(cfg.LocalServerBindAddress)
+// receiveCodeViaLocalServer starts the local server and receives the authorization response.
+// The returned response has a valid code, and the verified ID token if ResponseTypeCodeIDToken is set.
+func receiveCodeViaLocalServer(ctx context.Context, cfg *Config) (*authorizationResponse, error) {
+	localServerListener, localServerURL, err := newLocalServerListener(cfg)
 	if err != nil {
-		return "", fmt.Errorf("could not start a local server: %w", err)
+		return nil, err
 	}
 	defer func() {
 		// The listener may be closed by the server. No need to check the error.
 		_ = localServerListener.Close()
 	}()
-
 	if cfg.OAuth2Config.RedirectURL == "" {
-		var localServerURL url.URL
-		localServerURL.Host = fmt.Sprintf("localhost:%d", localServerListener.Addr().(*net.TCPAddr).Port)
-		localServerURL.Scheme = "http"
-		if cfg.isLocalServerHTTPS() {
-			localServerURL.Scheme = "https"
-		}
-		localServerURL.Path = cfg.LocalServerCallbackPath
-		cfg.OAuth2Config.RedirectURL = localServerURL.String()
+		cfg.OAuth2Config.RedirectURL = localServerURL
+	}
+	localServerIndexURL, err := indexURLOf(cfg.OAuth2Config.RedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OAuth2Config.RedirectURL: %w", err)
+	}
+
+	respCh := make(chan *authorizationResponse)
+	handler := &localServerHandler{
+		config: cfg,
+		respCh: respCh,
+	}
+	// The buffer ensures the reader does not block after the flow is finished.
+	pasteCh := make(chan *authorizationResponse, 1)
+	if cfg.RedirectURLReader != nil {
+		// Reading the reader cannot be canceled, so this is not part of the errgroup.
+		go handler.readRedirectURL(ctx, cfg.RedirectURLReader, pasteCh)
+	}
+	resp, err := serveLocalServer(ctx, cfg, localServerListener, localServerIndexURL, handler, respCh, pasteCh)
+	if err != nil {
+		return nil, fmt.Errorf("authorization error: %w", err)
+	}
+	if resp == nil {
+		return nil, errors.New("no authorization response")
+	}
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	return resp, nil
+}
+
+// newLocalServerListener opens a listener for the local server.
+// It returns the listener and the URL of the local server with LocalServerCallbackPath.
+func newLocalServerListener(cfg *Config) (net.Listener, string, error) {
+	localServerListener, err := listener.New(cfg.LocalServerBindAddress)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not start a local server: %w", err)
 	}
+	var localServerURL url.URL
+	localServerURL.Host = fmt.Sprintf("localhost:%d", localServerListener.Addr().(*net.TCPAddr).Port)
+	localServerURL.Scheme = "http"
+	if cfg.isLocalServerHTTPS() {
+		localServerURL.Scheme = "https"
+	}
+	localServerURL.Path = cfg.LocalServerCallbackPath
+	return localServerListener, localServerURL.String(), nil
+}
 
-	oauth2RedirectURL, err := url.Parse(cfg.OAuth2Config.RedirectURL)
+// indexURLOf returns the URL of the index page of the local server.
+func indexURLOf(redirectURL string) (string, error) {
+	u, err := url.Parse(redirectURL)
 	if err != nil {
-		return "", fmt.Errorf("invalid OAuth2Config.RedirectURL: %w", err)
+		return "", err
 	}
-	localServerIndexURL, err := oauth2RedirectURL.Parse("/")
+	localServerIndexURL, err := u.Parse("/")
 	if err != nil {
 		return "", fmt.Errorf("construct the index URL: %w", err)
 	}
+	return localServerIndexURL.String(), nil
+}
 
-	respCh := make(chan *authorizationResponse)
+// serveLocalServer starts the local server with the handler, and waits for a response.
+// The handler must send a response to respCh at most once, and extraCh is an optional source of the response.
+// It shuts down the server when a response is received or ctx is done.
+// It returns the zero value if the server has stopped without any response.
+func serveLocalServer[T any](ctx context.Context, cfg *Config, localServerListener net.Listener, localServerIndexURL string,
+	handler http.Handler, respCh chan T, extraCh <-chan T) (T, error) {
 	server := http.Server{
-		Handler: cfg.LocalServerMiddleware(&localServerHandler{
-			config: cfg,
-			respCh: respCh,
-		}),
+		Handler: cfg.LocalServerMiddleware(handler),
+		// The handler calls the provider with the HTTP client of ctx, such as PAR or JWKS.
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 	shutdownCh := make(chan struct{})
-	var resp *authorizationResponse
+	var resp T
 	var eg errgroup.Group
 	eg.Go(func() error {
 		defer close(respCh)
@@ -80,6 +131,9 @@ func receiveCodeViaLocalServer(ctx context.Context, cfg *Config) (string, error)
 				resp = gotResp
 			}
 			return nil
+		case gotResp := <-extraCh:
+			resp = gotResp
+			return nil
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -104,30 +158,32 @@ func receiveCodeViaLocalServer(ctx context.Context, cfg *Config) (string, error)
 			return nil
 		}
 		select {
-		case cfg.LocalServerReadyChan <- localServerIndexURL.String():
+		case cfg.LocalServerReadyChan <- localServerIndexURL:
 			return nil
 		case <-ctx.Done():
 			return ctx.Err()
 		}
 	})
 	if err := eg.Wait(); err != nil {
-		return "", fmt.Errorf("authorization error: %w", err)
+		var zero T
+		return zero, err
 	}
-	if resp == nil {
-		return "", errors.New("no authorization response")
-	}
-	return resp.code, resp.err
+	return resp, nil
 }
 
 type authorizationResponse struct {
-	code string // non-empty if a valid code is received
-	err  error  // non-nil if an error is received or any error occurs
+	code    string   // non-empty if a valid code is received
+	idToken *IDToken // non-nil if a valid ID token is received in the hybrid flow
+	err     error    // non-nil if an error is received or any error occurs
 }
 
 type localServerHandler struct {
 	config     *Config
 	respCh     chan<- *authorizationResponse // channel to send a response to
 	onceRespCh sync.Once                     // ensure send once
+
+	parMu sync.Mutex
+	par   *pushedAuthorizationRequest // request_uri of the pushed authorization request
 }
 
 func (h *localServerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -135,15 +191,20 @@ func (h *localServerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if callbackPath == "" {
 		callbackPath = "/"
 	}
+	isCallback := r.URL.Path == callbackPath && (r.Method == "GET" || r.Method == "POST")
 	q := r.URL.Query()
+	if isCallback && r.Method == "POST" {
+		// response_mode=form_post
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		q = r.PostForm
+	}
 	switch {
-	case r.Method == "GET" && r.URL.Path == callbackPath && q.Get("error") != "":
+	case isCallback && h.isAuthorizationResponse(q):
 		h.onceRespCh.Do(func() {
-			h.respCh <- h.handleErrorResponse(w, r)
-		})
-	case r.Method == "GET" && r.URL.Path == callbackPath && q.Get("code") != "":
-		h.onceRespCh.Do(func() {
-			h.respCh <- h.handleCodeResponse(w, r)
+			h.respCh <- h.handleAuthorizationResponse(w, r, q)
 		})
 	case r.Method == "GET" && r.URL.Path == "/":
 		h.handleIndex(w, r)
@@ -153,23 +214,77 @@ func (h *localServerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *localServerHandler) handleIndex(w http.ResponseWriter, r *http.Request) {
-	authCodeURL := h.config.OAuth2Config.AuthCodeURL(h.config.State, h.config.AuthCodeOptions...)
+	authCodeURL, err := h.authorizationRequestURL(r.Context())
+	if err != nil {
+		h.authorizationError(w, r)
+		h.onceRespCh.Do(func() {
+			h.respCh <- &authorizationResponse{err: err}
+		})
+		return
+	}
 	h.config.Logf("oauth2cli: sending redirect to %s", authCodeURL)
 	http.Redirect(w, r, authCodeURL, http.StatusFound)
 }
 
-func (h *localServerHandler) handleCodeResponse(w http.ResponseWriter, r *http.Request) *authorizationResponse {
-	q := r.URL.Query()
-	code, state := q.Get("code"), q.Get("state")
+func (h *localServerHandler) authorizationRequestURL(ctx context.Context) (string, error) {
+	if h.config.PushedAuthorizationRequestURL == "" && h.config.RequestObjectSigner == nil {
+		return h.config.authCodeURL()
+	}
+	if h.config.PushedAuthorizationRequestURL == "" {
+		params, err := h.authorizationRequestParams()
+		if err != nil {
+			return "", err
+		}
+		return appendQuery(h.config.OAuth2Config.Endpoint.AuthURL, params), nil
+	}
+
+	h.parMu.Lock()
+	defer h.parMu.Unlock()
+	if !h.par.valid() {
+		params, err := h.authorizationRequestParams()
+		if err != nil {
+			return "", err
+		}
+		par, err := pushAuthorizationRequest(ctx, h.config, params)
+		if err != nil {
+			return "", err
+		}
+		h.par = par
+	}
+	return appendQuery(h.config.OAuth2Config.Endpoint.AuthURL, url.Values{
+		"client_id":   {h.config.OAuth2Config.ClientID},
+		"request_uri": {h.par.requestURI},
+	}), nil
+}
+
+func (h *localServerHandler) authorizationRequestParams() (url.Values, error) {
+	params, err := h.config.authorizationRequestParams()
+	if err != nil {
+		return nil, err
+	}
+	if h.config.RequestObjectSigner != nil {
+		return newRequestObjectParams(h.config, params)
+	}
+	return params, nil
+}
+
+func (h *localServerHandler) isAuthorizationResponse(q url.Values) bool {
+	if h.config.JARMResponseMode != "" && q.Get("response") != "" {
+		return true
+	}
+	return q.Get("error") != "" || q.Get("code") != ""
+}
 
-	if state != h.config.State {
+func (h *localServerHandler) handleAuthorizationResponse(w http.ResponseWriter, r *http.Request, q url.Values) *authorizationResponse {
+	resp := h.validateAuthorizationResponse(r.Context(), q)
+	if resp.err != nil {
 		h.authorizationError(w, r)
-		return &authorizationResponse{err: fmt.Errorf("state does not match (wants %s but got %s)", h.config.State, state)}
+		return resp
 	}
 
 	if h.config.SuccessRedirectURL != "" {
 		http.Redirect(w, r, h.config.SuccessRedirectURL, http.StatusFound)
-		return &authorizationResponse{code: code}
+		return resp
 	}
 
 	w.Header().Add("Content-Type", "text/html")
@@ -177,16 +292,83 @@ func (h *localServerHandler) handleCodeResponse(w http.ResponseWriter, r *http.R
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return &authorizationResponse{err: fmt.Errorf("write error: %w", err)}
 	}
+	return resp
+}
+
+// validateAuthorizationResponse validates the parameters of the authorization response.
+// This is shared by the local server and the redirect URL pasted by the user.
+func (h *localServerHandler) validateAuthorizationResponse(ctx context.Context, q url.Values) *authorizationResponse {
+	if h.config.JARMResponseMode != "" && (q.Has("response") || q.Has("code")) {
+		// The authorization response must be a signed JWT.
+		// Otherwise, an attacker may inject a plain code.
+		claims, err := verifyJARMResponse(ctx, h.config, q.Get("response"))
+		if err != nil {
+			return &authorizationResponse{err: err}
+		}
+		q = claims
+	}
+	if q.Get("error") != "" {
+		return h.validateErrorResponse(q)
+	}
+	return h.validateCodeResponse(ctx, q)
+}
+
+func (h *localServerHandler) validateCodeResponse(ctx context.Context, q url.Values) *authorizationResponse {
+	code, state := q.Get("code"), q.Get("state")
+	if err := verifyIssuerParameter(h.config, q); err != nil {
+		return &authorizationResponse{err: err}
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(h.config.State)) != 1 {
+		return &authorizationResponse{err: fmt.Errorf("state does not match (wants %s but got %s)", h.config.State, state)}
+	}
+	if h.config.ResponseTypeCodeIDToken {
+		idToken, err := verifyHybridIDToken(ctx, h.config, q.Get("id_token"), code)
+		if err != nil {
+			return &authorizationResponse{err: err}
+		}
+		return &authorizationResponse{code: code, idToken: idToken}
+	}
 	return &authorizationResponse{code: code}
 }
 
-func (h *localServerHandler) handleErrorResponse(w http.ResponseWriter, r *http.Request) *authorizationResponse {
-	q := r.URL.Query()
+func (h *localServerHandler) validateErrorResponse(q url.Values) *authorizationResponse {
 	errorCode, errorDescription := q.Get("error"), q.Get("error_description")
-	h.authorizationError(w, r)
+	if err := verifyIssuerParameter(h.config, q); err != nil {
+		return &authorizationResponse{err: err}
+	}
 	return &authorizationResponse{err: fmt.Errorf("authorization error from server: %s %s", errorCode, errorDescription)}
 }
 
+// readRedirectURL reads the redirect URL pasted by the user, line by line.
+// It sends the authorization response to pasteCh if the local server has not received one.
+// It returns when a redirect URL is read, or the reader reaches EOF.
+func (h *localServerHandler) readRedirectURL(ctx context.Context, reader io.Reader, pasteCh chan<- *authorizationResponse) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		redirectURL, err := url.Parse(line)
+		if err != nil {
+			h.config.Logf("oauth2cli: invalid redirect URL: %s", err)
+			continue
+		}
+		q := redirectURL.Query()
+		if !h.isAuthorizationResponse(q) {
+			h.config.Logf("oauth2cli: the redirect URL does not contain an authorization response")
+			continue
+		}
+		h.onceRespCh.Do(func() {
+			pasteCh <- h.validateAuthorizationResponse(ctx, q)
+		})
+		return
+	}
+	if err := scanner.Err(); err != nil {
+		h.config.Logf("oauth2cli: could not read the redirect URL: %s", err)
+	}
+}
+
 func (h *localServerHandler) authorizationError(w http.ResponseWriter, r *http.Request) {
 	if h.config.FailureRedirectURL != "" {
 		http.Redirect(w, r, h.config.FailureRedirectURL, http.StatusFound)
@@ -0,0 +1,299 @@
+package oauth2cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenCache is an interface to store the token between the runs of a command.
+// See FileTokenCache for the implementation on the file system.
+type TokenCache interface {
+	// Load returns the token of the key.
+	// It returns nil and no error if the token is not found.
+	Load(key TokenCacheKey) (*oauth2.Token, error)
+
+	// Save stores the token of the key.
+	Save(key TokenCacheKey, token *oauth2.Token) error
+
+	// Delete removes the token of the key.
+	// It returns no error if the token is not found.
+	Delete(key TokenCacheKey) error
+}
+
+// TokenCacheKey represents the key of a cached token.
+// It contains the parameters which shape the token, so that a token is not reused for another request.
+type TokenCacheKey struct {
+	Issuer                  string     `json:"issuer"`
+	ClientID                string     `json:"client_id"`
+	Scopes                  []string   `json:"scopes,omitempty"`
+	Resources               []string   `json:"resources,omitempty"`
+	AuthorizationParameters url.Values `json:"authorization_parameters,omitempty"`
+	DPoPKeyThumbprint       string     `json:"dpop_jkt,omitempty"`
+	Profile                 string     `json:"profile,omitempty"`
+}
+
+// perRequestAuthorizationParameters are excluded from TokenCacheKey.AuthorizationParameters,
+// because they are generated for each request or represented by another field of the key.
+var perRequestAuthorizationParameters = []string{
+	"client_id", "redirect_uri", "response_type", "scope", "state", "nonce",
+	"code_challenge", "code_challenge_method", "login_hint",
+}
+
+// TokenCacheKeyOf returns the key of the token for cfg.
+// The issuer is Issuer, or OAuth2Config.Endpoint.TokenURL if not set.
+// The scopes and resources are sorted, so that the order does not change the key.
+// The authorization parameters are given by AuthCodeOptions, such as authorization_details or prompt.
+// The profile is Config.Profile, so that each account has its own token.
+func TokenCacheKeyOf(cfg Config) TokenCacheKey {
+	issuer := cfg.Issuer
+	if issuer == "" {
+		issuer = cfg.OAuth2Config.Endpoint.TokenURL
+	}
+	key := TokenCacheKey{
+		Issuer:                  issuer,
+		ClientID:                cfg.OAuth2Config.ClientID,
+		Scopes:                  sortedUnique(cfg.OAuth2Config.Scopes),
+		Resources:               sortedUnique(cfg.Resources),
+		AuthorizationParameters: authorizationParametersOf(cfg),
+		Profile:                 cfg.Profile,
+	}
+	if cfg.DPoPKey != nil {
+		// An invalid key is rejected on the token request.
+		key.DPoPKeyThumbprint, _ = dpopThumbprint(cfg.DPoPKey)
+	}
+	return key
+}
+
+func sortedUnique(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return slices.Compact(s)
+}
+
+// authorizationParametersOf returns the parameters of AuthCodeOptions except the per-request ones.
+func authorizationParametersOf(cfg Config) url.Values {
+	if len(cfg.AuthCodeOptions) == 0 {
+		return nil
+	}
+	u, err := url.Parse(cfg.OAuth2Config.AuthCodeURL("", cfg.AuthCodeOptions...))
+	if err != nil {
+		return nil
+	}
+	q := u.Query()
+	for _, k := range perRequestAuthorizationParameters {
+		q.Del(k)
+	}
+	if len(q) == 0 {
+		return nil
+	}
+	return q
+}
+
+// tokenCacheExtraKeys are the fields of the token response to keep in the cache.
+var tokenCacheExtraKeys = []string{"id_token", "scope", "authorization_details"}
+
+// cachedToken represents the serialized form of a token.
+type cachedToken struct {
+	AccessToken  string         `json:"access_token"`
+	TokenType    string         `json:"token_type,omitempty"`
+	RefreshToken string         `json:"refresh_token,omitempty"`
+	Expiry       time.Time      `json:"expiry,omitzero"`
+	Extra        map[string]any `json:"extra,omitempty"`
+}
+
+func newCachedToken(token *oauth2.Token) cachedToken {
+	c := cachedToken{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	}
+	for _, k := range tokenCacheExtraKeys {
+		if v := token.Extra(k); v != nil {
+			if c.Extra == nil {
+				c.Extra = make(map[string]any)
+			}
+			c.Extra[k] = v
+		}
+	}
+	return c
+}
+
+func (c cachedToken) token() *oauth2.Token {
+	token := &oauth2.Token{
+		AccessToken:  c.AccessToken,
+		TokenType:    c.TokenType,
+		RefreshToken: c.RefreshToken,
+		Expiry:       c.Expiry,
+	}
+	if c.Extra != nil {
+		return token.WithExtra(c.Extra)
+	}
+	return token
+}
+
+// FileTokenCache stores each token in a JSON file of the directory.
+// The file is readable only by the owner, and written atomically by renaming a temporary file.
+type FileTokenCache struct {
+	// Directory to store the files.
+	// It is created with the permission 0700 if it does not exist.
+	Dir string
+}
+
+type tokenCacheFile struct {
+	Key   TokenCacheKey `json:"key"`
+	Token cachedToken   `json:"token"`
+}
+
+// Load returns the token of the key.
+func (c *FileTokenCache) Load(key TokenCacheKey) (*oauth2.Token, error) {
+	name, err := c.fileName(key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the token cache: %w", err)
+	}
+	var f tokenCacheFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("invalid token cache %s: %w", name, err)
+	}
+	return f.Token.token(), nil
+}
+
+// Save stores the token of the key.
+func (c *FileTokenCache) Save(key TokenCacheKey, token *oauth2.Token) error {
+	name, err := c.fileName(key)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(tokenCacheFile{Key: key, Token: newCachedToken(token)}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode the token: %w", err)
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return fmt.Errorf("could not create the token cache directory: %w", err)
+	}
+	if err := writeFileAtomically(name, b); err != nil {
+		return fmt.Errorf("could not write the token cache: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the token of the key.
+func (c *FileTokenCache) Delete(key TokenCacheKey) error {
+	name, err := c.fileName(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove the token cache: %w", err)
+	}
+	return nil
+}
+
+// fileName returns the path of the file by the hash of the key.
+func (c *FileTokenCache) fileName(key TokenCacheKey) (string, error) {
+	if c.Dir == "" {
+		return "", errors.New("Dir of FileTokenCache must be set")
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("could not encode the token cache key: %w", err)
+	}
+	h := sha256.Sum256(b)
+	return filepath.Join(c.Dir, hex.EncodeToString(h[:])+".json"), nil
+}
+
+// writeFileAtomically writes the file with the permission 0600.
+// It writes a temporary file in the same directory and renames it,
+// so that a reader never sees a partially written file.
+func writeFileAtomically(name string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// The temporary file is removed if it has not been renamed. No need to check the error.
+		_ = os.Remove(f.Name())
+	}()
+	if err := f.Chmod(0600); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// loadCachedToken returns the cached token of cfg, or nil if not found.
+// An error of the cache is logged, because the token can be retrieved again.
+func loadCachedToken(cfg *Config) *oauth2.Token {
+	token, err := cfg.TokenCache.Load(TokenCacheKeyOf(*cfg))
+	if err != nil {
+		cfg.Logf("oauth2cli: could not load the cached token: %s", err)
+		return nil
+	}
+	return token
+}
+
+// validCachedToken returns the cached token of cfg if it is valid, or nil.
+// It returns the verified ID token if available.
+func validCachedToken(ctx context.Context, cfg *Config) (*oauth2.Token, *IDToken) {
+	token := loadCachedToken(cfg)
+	if !token.Valid() {
+		return nil, nil
+	}
+	idToken, err := verifyCachedToken(ctx, cfg, token)
+	if err != nil {
+		cfg.Logf("oauth2cli: ignoring the cached token: %s", err)
+		return nil, nil
+	}
+	cfg.Logf("oauth2cli: using the cached token")
+	return token, idToken
+}
+
+// verifyCachedToken verifies the ID token of the cached token in the same way as a token response,
+// if Nonce, MaxAge or ACRValues is set, or if Issuer and JWKSURL are set.
+// For example, a token of an earlier login without MFA is rejected when ACRValues requires it.
+func verifyCachedToken(ctx context.Context, cfg *Config, token *oauth2.Token) (*IDToken, error) {
+	_, hasIDToken := token.Extra("id_token").(string)
+	if cfg.Nonce != "" || cfg.MaxAge > 0 || len(cfg.ACRValues) > 0 ||
+		(cfg.Issuer != "" && cfg.JWKSURL != "" && hasIDToken) {
+		return verifyTokenResponseIDToken(ctx, cfg, token)
+	}
+	return nil, nil
+}
+
+// saveCachedToken stores the token of cfg.
+// An error of the cache is logged, because the token has been retrieved anyway.
+func saveCachedToken(cfg *Config, token *oauth2.Token) {
+	if err := cfg.TokenCache.Save(TokenCacheKeyOf(*cfg), token); err != nil {
+		cfg.Logf("oauth2cli: could not save the token to the cache: %s", err)
+	}
+}
@@ -0,0 +1,150 @@
+package oauth2cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// NewTokenSource returns an oauth2.TokenSource which refreshes the token,
+// and falls back to the interactive GetToken when the token cannot be refreshed.
+//
+// The token is used as-is while it is valid.
+// When it has expired, the source sends the refresh token grant.
+// If the token has no refresh token, or the provider responds invalid_grant,
+// i.e., the refresh token has expired or been revoked, it performs GetToken with cfg.
+// Any other error of the refresh, such as a network error, is returned without the interactive login.
+// token may be nil to perform GetToken on the first call.
+// If cfg.TokenCache is set and token is nil, the cached token is used instead,
+// and the refreshed token is saved to the cache.
+//
+// The returned source is safe for concurrent use.
+// The concurrent calls are serialized, so that the browser is opened only once.
+// ctx is used for both the refresh and GetToken, like oauth2.Config.TokenSource.
+func NewTokenSource(ctx context.Context, cfg Config, token *oauth2.Token) oauth2.TokenSource {
+	if cfg.Logf == nil {
+		cfg.Logf = func(string, ...interface{}) {}
+	}
+	return &tokenSource{ctx: ctx, cfg: cfg, token: token}
+}
+
+type tokenSource struct {
+	ctx   context.Context
+	cfg   Config
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil && s.cfg.TokenCache != nil {
+		if _, err := s.cfg.resolveProfile(); err != nil {
+			return nil, fmt.Errorf("could not load the profile: %w", err)
+		}
+		s.token = loadCachedToken(&s.cfg)
+		if s.token.Valid() {
+			if _, err := verifyCachedToken(s.ctx, &s.cfg, s.token); err != nil {
+				s.cfg.Logf("oauth2cli: ignoring the cached token: %s", err)
+				s.token = nil
+			}
+		}
+	}
+	if s.token.Valid() {
+		return s.token, nil
+	}
+	if s.token != nil && s.token.RefreshToken != "" {
+		token, err := s.refresh()
+		if err == nil {
+			s.token = token
+			if s.cfg.TokenCache != nil {
+				saveCachedToken(&s.cfg, token)
+			}
+			return token, nil
+		}
+		var retrieveErr *oauth2.RetrieveError
+		if !errors.As(err, &retrieveErr) || retrieveErr.ErrorCode != "invalid_grant" {
+			return nil, fmt.Errorf("could not refresh the token: %w", err)
+		}
+		s.cfg.Logf("oauth2cli: falling back to the authorization code flow because the refresh token is invalid: %s", err)
+	}
+	token, err := GetToken(s.ctx, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// refresh sends the refresh token grant.
+// The refresh token is kept if the provider does not rotate it.
+// The ID token and scope are kept if the refresh response does not contain them,
+// because the provider may omit them.
+// If the refresh response contains an ID token, it must be valid and have the same sub as the previous one.
+// See https://openid.net/specs/openid-connect-core-1_0.html#RefreshTokenResponse
+func (s *tokenSource) refresh() (*oauth2.Token, error) {
+	ctx := s.ctx
+	if s.cfg.DPoPKey != nil {
+		ctx = withDPoPClient(ctx, s.cfg.DPoPKey)
+	}
+	token, err := s.cfg.OAuth2Config.TokenSource(ctx, s.token).Token()
+	if err != nil {
+		return nil, err
+	}
+	if rawIDToken, ok := token.Extra("id_token").(string); ok && rawIDToken != "" {
+		if err := s.verifyRefreshedIDToken(token); err != nil {
+			return nil, err
+		}
+	}
+	return inheritTokenExtra(token, s.token), nil
+}
+
+// verifyRefreshedIDToken verifies the ID token in the refresh response.
+func (s *tokenSource) verifyRefreshedIDToken(token *oauth2.Token) error {
+	cfg := s.cfg
+	// The ID token in the refresh response does not contain the nonce of the authorization request.
+	cfg.Nonce = ""
+	if _, err := verifyTokenResponseIDToken(s.ctx, &cfg, token); err != nil {
+		return err
+	}
+	previousSubject, err := idTokenSubjectOf(s.token)
+	if err != nil {
+		// The previous token has no ID token to compare.
+		return nil
+	}
+	subject, err := idTokenSubjectOf(token)
+	if err != nil {
+		return &IDTokenVerificationError{Err: err}
+	}
+	if subject != previousSubject {
+		return &IDTokenVerificationError{Claim: "sub",
+			Err: fmt.Errorf("sub does not match the previous ID token (wants %s but got %s)", previousSubject, subject)}
+	}
+	return nil
+}
+
+// inheritTokenExtra returns the token with id_token and scope of the previous token,
+// if the token does not contain them.
+func inheritTokenExtra(token, previous *oauth2.Token) *oauth2.Token {
+	extra := make(map[string]any)
+	var inherited bool
+	for _, k := range tokenCacheExtraKeys {
+		if v := token.Extra(k); v != nil && v != "" {
+			extra[k] = v
+			continue
+		}
+		if k == "id_token" || k == "scope" {
+			if v := previous.Extra(k); v != nil && v != "" {
+				extra[k] = v
+				inherited = true
+			}
+		}
+	}
+	if !inherited {
+		return token
+	}
+	return token.WithExtra(extra)
+}
@@ -0,0 +1,152 @@
+package oauth2cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/int128/oauth2cli/internal/jwt"
+	"golang.org/x/oauth2"
+)
+
+// ErrSubjectMismatch is returned when the sub claim of the UserInfo response
+// does not match the sub claim of the ID token, which may be a token substitution attack.
+// See https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse
+var ErrSubjectMismatch = errors.New("subject does not match")
+
+// UserInfo represents the claims of the UserInfo response of OpenID Connect.
+// See https://openid.net/specs/openid-connect-core-1_0.html#StandardClaims
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+
+	payload []byte
+}
+
+// Claims decodes the claims of the UserInfo response into v.
+// This is useful to get the claims which are not contained in UserInfo.
+func (u *UserInfo) Claims(v any) error {
+	if err := json.Unmarshal(u.payload, v); err != nil {
+		return fmt.Errorf("could not decode the claims: %w", err)
+	}
+	return nil
+}
+
+// DisplayName returns a name to show the logged-in user,
+// such as "Logged in as ...".
+// It returns the first non-empty value of email, preferred_username, name or sub.
+func (u *UserInfo) DisplayName() string {
+	for _, v := range []string{u.Email, u.PreferredUsername, u.Name} {
+		if v != "" {
+			return v
+		}
+	}
+	return u.Subject
+}
+
+type userInfoJWTClaims struct {
+	Issuer   string       `json:"iss"`
+	Audience jwt.Audience `json:"aud"`
+}
+
+// GetUserInfo retrieves the claims of the user from UserInfoURL by the access token.
+// The token must contain the ID token, that is, the token returned by GetToken with openid scope.
+//
+// The UserInfo response may be a JSON or a signed JWT.
+// If it is a JWT, the signature is verified by the key set of JWKSURL, and iss and aud claims are checked.
+// If the sub claim does not match the ID token, it returns an error wrapping ErrSubjectMismatch.
+// If DPoPKey is set, the access token is sent with a DPoP proof.
+// See https://openid.net/specs/openid-connect-core-1_0.html#UserInfo
+func GetUserInfo(ctx context.Context, cfg Config, token *oauth2.Token) (*UserInfo, error) {
+	if err := cfg.validateAndSetDefaults(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.UserInfoURL == "" {
+		return nil, errors.New("invalid config: UserInfoURL must be set")
+	}
+	idTokenSubject, err := idTokenSubjectOf(token)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.UserInfoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create a request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, application/jwt")
+	if cfg.DPoPKey != nil && token.Type() == "DPoP" {
+		hc := *contextClient(ctx)
+		hc.Transport = &DPoPTransport{Key: cfg.DPoPKey, Source: oauth2.StaticTokenSource(token), Base: hc.Transport}
+		req = req.WithContext(context.WithValue(ctx, oauth2.HTTPClient, &hc))
+	} else {
+		token.SetAuthHeader(req)
+	}
+	resp, body, err := doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the user info from %s: %w", cfg.UserInfoURL, err)
+	}
+	payload := body
+	if content, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); content == "application/jwt" {
+		payload, err = verifyUserInfoJWT(ctx, &cfg, string(body))
+		if err != nil {
+			return nil, err
+		}
+	}
+	userInfo := UserInfo{payload: payload}
+	if err := json.Unmarshal(payload, &userInfo); err != nil {
+		return nil, fmt.Errorf("invalid user info: %w", err)
+	}
+	if userInfo.Subject != idTokenSubject {
+		return nil, fmt.Errorf("%w: wants %s but got %s", ErrSubjectMismatch, idTokenSubject, userInfo.Subject)
+	}
+	return &userInfo, nil
+}
+
+// verifyUserInfoJWT verifies the signed UserInfo response and returns the payload.
+// See https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse
+func verifyUserInfoJWT(ctx context.Context, cfg *Config, s string) ([]byte, error) {
+	if cfg.JWKSURL == "" {
+		return nil, errors.New("JWKSURL must be set to verify the signed user info")
+	}
+	token, err := verifyJWT(ctx, cfg, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user info JWT: %w", err)
+	}
+	var claims userInfoJWTClaims
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid user info JWT: %w", err)
+	}
+	if cfg.Issuer != "" && claims.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("iss of the user info JWT does not match (wants %s but got %s)", cfg.Issuer, claims.Issuer)
+	}
+	if !claims.Audience.Contains(cfg.OAuth2Config.ClientID) {
+		return nil, fmt.Errorf("aud of the user info JWT does not contain the client ID %s", cfg.OAuth2Config.ClientID)
+	}
+	return token.Payload, nil
+}
+
+// idTokenSubjectOf returns the sub claim of the ID token in the token response.
+// The signature is not verified here, because it has been verified on the token response.
+func idTokenSubjectOf(token *oauth2.Token) (string, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return "", errors.New("id_token is required to check the subject of the user info")
+	}
+	idToken, err := jwt.Parse(rawIDToken)
+	if err != nil {
+		return "", fmt.Errorf("invalid ID token: %w", err)
+	}
+	var claims idTokenClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return "", fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.Subject == "" {
+		return "", errors.New("sub of the ID token is missing")
+	}
+	return claims.Subject, nil
+}